@@ -0,0 +1,34 @@
+package gear
+
+import (
+	"strings"
+)
+
+// BearerToken returns the token in the "Authorization: Bearer <token>" header of the request.
+// The scheme "Bearer" is matched case-insensitively. If there is no such header,
+// the scheme is not Bearer or the token is empty, BearerToken returns false.
+func (g *Gear) BearerToken() (token string, ok bool) {
+	scheme, token, found := strings.Cut(g.R.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// APIKey returns the API key in the request header named header, or if absent,
+// in the URL query named query. An empty header or query means not to check it.
+// If the key is not found or empty, APIKey returns false.
+func (g *Gear) APIKey(header, query string) (key string, ok bool) {
+	if header != "" {
+		if key = strings.TrimSpace(g.R.Header.Get(header)); key != "" {
+			return key, true
+		}
+	}
+	if query != "" {
+		if key = g.Query().Get(query); key != "" {
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,68 @@
+package gear_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+func TestBearerToken(t *testing.T) {
+	var tests = []struct {
+		auth  string
+		token string
+		ok    bool
+	}{
+		{"Bearer abc", "abc", true},
+		{"bearer abc", "abc", true},
+		{"BEARER  abc ", "abc", true},
+		{"Basic abc", "", false},
+		{"Bearer", "", false},
+		{"Bearer ", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		var token string
+		var ok bool
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok = gear.G(r).BearerToken()
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if token != test.token || ok != test.ok {
+			t.Fatal(test, token, ok)
+		}
+	}
+}
+
+func TestAPIKey(t *testing.T) {
+	var tests = []struct {
+		url    string
+		header string
+		key    string
+		ok     bool
+	}{
+		{"/?api_key=q", "h", "h", true},
+		{"/?api_key=q", "", "q", true},
+		{"/", "", "", false},
+	}
+	for _, test := range tests {
+		var key string
+		var ok bool
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok = gear.G(r).APIKey("X-API-Key", "api_key")
+		})
+		r := httptest.NewRequest(http.MethodGet, test.url, nil)
+		if test.header != "" {
+			r.Header.Set("X-API-Key", test.header)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if key != test.key || ok != test.ok {
+			t.Fatal(test, key, ok)
+		}
+	}
+}
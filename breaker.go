@@ -0,0 +1,262 @@
+package gear
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a circuit breaker, see [CircuitBreaker].
+type BreakerState int
+
+const (
+	// BreakerClosed is the normal state, requests are served.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen is the tripped state, requests are rejected.
+	BreakerOpen
+	// BreakerHalfOpen is the probing state after cooldown, a single request is served to test recovery.
+	BreakerHalfOpen
+)
+
+// String implements [fmt.Stringer].
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "BreakerState(" + strconv.Itoa(int(s)) + ")"
+	}
+}
+
+// BreakerOptions are options for [CircuitBreaker]. A zero BreakerOptions consists entirely of zero values.
+type BreakerOptions struct {
+	// Window is the length of the rolling window in which the error rate is computed.
+	// Zero value means 10 seconds.
+	Window time.Duration
+	// Threshold is the error rate(0..1) at or above which the breaker opens.
+	// Zero value means 0.5.
+	Threshold float64
+	// MinRequests is the minimum number of requests in the window before the breaker can open.
+	// Zero value means 20.
+	MinRequests int
+	// Cooldown is how long the breaker stays open before half-opening.
+	// Zero value means 30 seconds.
+	Cooldown time.Duration
+	// Key returns the key of the breaker for r. Requests with different keys are tracked separately.
+	// Zero value means the matched route pattern of [http.ServeMux] is used if available(Go 1.23 or later),
+	// so the requests are tracked per route when the breaker is added to the routes, see [Group] and [HandleMethod].
+	// Before routing, the pattern is empty and all the requests share a single state.
+	// The state of a key is dropped once it is closed and has no requests in the window, so keys
+	// taken from the client, such as paths or headers, do not accumulate.
+	Key func(r *http.Request) string
+}
+
+// breakerBuckets is the number of buckets in the rolling window.
+const breakerBuckets = 10
+
+// breakerBucket counts the requests in a slot of the rolling window.
+type breakerBucket struct {
+	start    int64 // Start of the slot, in number of bucket durations since epoch.
+	total    int
+	failures int
+}
+
+// breakerEntry is the state of a breaker key.
+type breakerEntry struct {
+	state     BreakerState
+	openUntil time.Time
+	probing   bool // Whether the probe request is in flight in half-open state.
+	buckets   [breakerBuckets]breakerBucket
+}
+
+// idle returns whether entry is closed and has no requests in the window of slot,
+// which is the same as no entry.
+func (entry *breakerEntry) idle(slot int64) bool {
+	if entry.state != BreakerClosed {
+		return false
+	}
+	for _, bucket := range entry.buckets {
+		if bucket.total > 0 && slot-bucket.start < breakerBuckets {
+			return false
+		}
+	}
+	return true
+}
+
+// Breaker is a circuit breaker [Middleware], see [CircuitBreaker].
+type Breaker struct {
+	window      time.Duration
+	bucketSize  time.Duration
+	threshold   float64
+	minRequests int
+	cooldown    time.Duration
+	key         func(r *http.Request) string
+
+	mu        sync.Mutex
+	entries   map[string]*breakerEntry
+	lastPrune int64 // Slot of the last pruning of idle entries.
+}
+
+// CircuitBreaker returns a [Middleware] protecting the handler from being hammered while it is failing.
+// The responses with status code 500 or above are failures. When the failure rate over the rolling window
+// reaches the threshold, the breaker opens, and the requests get a http.StatusServiceUnavailable response
+// with Retry-After header immediately for a cooldown period. Then the breaker half-opens and lets a single
+// request through to test recovery: the breaker closes if it succeeds, or opens again otherwise.
+// The return value is a *[Breaker], whose state can be inspected.
+// If opt is nil, the default options are used.
+func CircuitBreaker(opt *BreakerOptions) Middleware {
+	return NewBreaker(opt)
+}
+
+// NewBreaker is like [CircuitBreaker], but returns a *Breaker.
+func NewBreaker(opt *BreakerOptions) *Breaker {
+	var b = &Breaker{
+		window:      10 * time.Second,
+		threshold:   0.5,
+		minRequests: 20,
+		cooldown:    30 * time.Second,
+		key:         requestPattern,
+		entries:     make(map[string]*breakerEntry),
+	}
+	if opt != nil {
+		if opt.Window > 0 {
+			b.window = opt.Window
+		}
+		if opt.Threshold > 0 {
+			b.threshold = opt.Threshold
+		}
+		if opt.MinRequests > 0 {
+			b.minRequests = opt.MinRequests
+		}
+		if opt.Cooldown > 0 {
+			b.cooldown = opt.Cooldown
+		}
+		if opt.Key != nil {
+			b.key = opt.Key
+		}
+	}
+	b.bucketSize = max(b.window/breakerBuckets, 1)
+	return b
+}
+
+// State returns the state of the breaker for key.
+func (b *Breaker) State(key string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.entries[key]
+	if entry == nil {
+		return BreakerClosed
+	}
+	if entry.state == BreakerOpen && !time.Now().Before(entry.openUntil) {
+		return BreakerHalfOpen
+	}
+	return entry.state
+}
+
+// allow returns whether the request with key can be served, and whether it is the probe request.
+func (b *Breaker) allow(key string, now time.Time) (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry := b.entries[key]
+	if entry == nil {
+		return true, false
+	}
+	if entry.state == BreakerOpen && !now.Before(entry.openUntil) {
+		entry.state = BreakerHalfOpen
+	}
+	switch entry.state {
+	case BreakerOpen:
+		return false, false
+	case BreakerHalfOpen:
+		if entry.probing {
+			return false, false
+		}
+		entry.probing = true
+		return true, true
+	}
+	return true, false
+}
+
+// record records the result of a request with key.
+func (b *Breaker) record(key string, now time.Time, failed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var slot = now.UnixNano() / int64(b.bucketSize)
+	if slot-b.lastPrune >= breakerBuckets { // Remove idle entries once a window.
+		b.lastPrune = slot
+		for k, entry := range b.entries {
+			if entry.idle(slot) {
+				delete(b.entries, k)
+			}
+		}
+	}
+	entry := b.entries[key]
+	if entry == nil {
+		entry = &breakerEntry{}
+		b.entries[key] = entry
+	}
+	if probe {
+		entry.probing = false
+		if failed {
+			entry.state = BreakerOpen
+			entry.openUntil = now.Add(b.cooldown)
+		} else {
+			*entry = breakerEntry{} // Closed, with counts reset.
+		}
+		return
+	}
+	if entry.state != BreakerClosed {
+		return // Request allowed before the breaker opened.
+	}
+	var bucket = &entry.buckets[slot%breakerBuckets]
+	if bucket.start != slot {
+		*bucket = breakerBucket{start: slot}
+	}
+	bucket.total++
+	if failed {
+		bucket.failures++
+	}
+	var total, failures int
+	for _, bucket := range entry.buckets {
+		if slot-bucket.start < breakerBuckets {
+			total += bucket.total
+			failures += bucket.failures
+		}
+	}
+	if total >= b.minRequests && float64(failures) >= b.threshold*float64(total) {
+		entry.state = BreakerOpen
+		entry.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// Serve implements [Middleware].
+func (b *Breaker) Serve(g *Gear, next func(*Gear)) {
+	var key = b.key(g.R)
+	allowed, probe := b.allow(key, time.Now())
+	if !allowed {
+		g.W.Header().Set("Retry-After", strconv.FormatInt(int64((b.cooldown+time.Second-1)/time.Second), 10))
+		g.Code(http.StatusServiceUnavailable)
+		g.Stop()
+		return
+	}
+	var w = g.W
+	var cw = newCaptureWriter(w, 0)
+	g.W = cw
+	var panicked = true
+	defer func() {
+		g.W = w
+		b.record(key, time.Now(), panicked || cw.status() >= http.StatusInternalServerError, probe)
+	}()
+	next(g)
+	panicked = false
+}
+
+// MiddlewareName implements [MiddlewareName].
+func (b *Breaker) MiddlewareName() string {
+	return "CircuitBreaker"
+}
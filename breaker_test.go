@@ -0,0 +1,101 @@
+package gear_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mkch/gear"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var breaker = gear.NewBreaker(&gear.BreakerOptions{
+		Threshold:   0.5,
+		MinRequests: 4,
+		Cooldown:    50 * time.Millisecond,
+		Key:         func(r *http.Request) string { return "k" },
+	})
+	var code = http.StatusInternalServerError
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}, breaker)
+	serve := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}
+
+	for i := 0; i < 4; i++ {
+		if state := breaker.State("k"); state != gear.BreakerClosed {
+			t.Fatal(i, state)
+		}
+		if c := serve(); c != http.StatusInternalServerError {
+			t.Fatal(c)
+		}
+	}
+	if state := breaker.State("k"); state != gear.BreakerOpen {
+		t.Fatal(state)
+	}
+	if c := serve(); c != http.StatusServiceUnavailable {
+		t.Fatal(c)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if state := breaker.State("k"); state != gear.BreakerHalfOpen {
+		t.Fatal(state)
+	}
+	// Failed probe opens the breaker again.
+	if c := serve(); c != http.StatusInternalServerError {
+		t.Fatal(c)
+	}
+	if c := serve(); c != http.StatusServiceUnavailable {
+		t.Fatal(c)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	code = http.StatusOK
+	if c := serve(); c != http.StatusOK {
+		t.Fatal(c)
+	}
+	if state := breaker.State("k"); state != gear.BreakerClosed {
+		t.Fatal(state)
+	}
+}
+
+func TestCircuitBreakerPrune(t *testing.T) {
+	var breaker = gear.NewBreaker(&gear.BreakerOptions{
+		Window:      20 * time.Millisecond,
+		MinRequests: 1,
+		Cooldown:    time.Minute,
+		Key:         func(r *http.Request) string { return r.URL.Path },
+	})
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}, breaker)
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	serve("/fail")
+	for i := 0; i < 3; i++ {
+		time.Sleep(30 * time.Millisecond) // The next request prunes idle entries, but keeps the open one.
+		if c := serve(fmt.Sprintf("/%v", i)); c != http.StatusOK {
+			t.Fatal(c)
+		}
+		if state := breaker.State("/fail"); state != gear.BreakerOpen {
+			t.Fatal(i, state)
+		}
+		if state := breaker.State(fmt.Sprintf("/%v", i)); state != gear.BreakerClosed {
+			t.Fatal(i, state)
+		}
+	}
+	if c := serve("/fail"); c != http.StatusServiceUnavailable {
+		t.Fatal(c)
+	}
+}
@@ -0,0 +1,86 @@
+package gear
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPOptions are options for [Gear.ClientIP]. A zero ClientIPOptions consists entirely of zero values.
+type ClientIPOptions struct {
+	// TrustedProxies are the CIDRs of trusted proxies.
+	// Zero value means no proxy is trusted, and X-Forwarded-For and X-Real-IP
+	// headers are ignored to avoid spoofing.
+	TrustedProxies []netip.Prefix
+}
+
+// trusted returns whether addr is a trusted proxy.
+func (opt *ClientIPOptions) trusted(addr netip.Addr) bool {
+	return prefixesContain(opt.TrustedProxies, addr)
+}
+
+// prefixesContain returns whether any of prefixes contains addr.
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteTrusted returns whether the remote address of r is in trustedProxies.
+func remoteTrusted(r *http.Request, trustedProxies []netip.Prefix) bool {
+	if len(trustedProxies) == 0 {
+		return false
+	}
+	var remote = r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	addr, err := netip.ParseAddr(remote)
+	return err == nil && prefixesContain(trustedProxies, addr.Unmap())
+}
+
+// ClientIP returns the IP address of the client.
+// If the remote address of the request is a trusted proxy(see [ClientIPOptions]),
+// X-Forwarded-For header is parsed right-to-left skipping trusted hops to find the
+// real client IP, and X-Real-IP header is used if there is no X-Forwarded-For header.
+// Otherwise, or if opt is nil, the host part of g.R.RemoteAddr is returned.
+func (g *Gear) ClientIP(opt *ClientIPOptions) string {
+	var remote = g.R.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if opt == nil || len(opt.TrustedProxies) == 0 {
+		return remote
+	}
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !opt.trusted(addr.Unmap()) {
+		return remote
+	}
+	var hops []string
+	for _, value := range g.R.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	if len(hops) == 0 {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(g.R.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap().String()
+		}
+		return remote
+	}
+	var client = remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break // Malformed hop, can't go further.
+		}
+		hop = hop.Unmap()
+		client = hop.String()
+		if !opt.trusted(hop) {
+			break
+		}
+	}
+	return client
+}
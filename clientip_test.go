@@ -0,0 +1,48 @@
+package gear_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+func TestClientIP(t *testing.T) {
+	var opt = &gear.ClientIPOptions{
+		TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}
+	var tests = []struct {
+		remote string
+		header http.Header
+		opt    *gear.ClientIPOptions
+		want   string
+	}{
+		{"192.0.2.1:1234", nil, opt, "192.0.2.1"},
+		{"192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, nil, "192.0.2.1"},
+		{"192.0.2.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, opt, "192.0.2.1"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, nil, "10.0.0.1"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"198.51.100.1, 10.0.0.2"}}, opt, "198.51.100.1"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"203.0.113.9, 198.51.100.1", "10.0.0.2"}}, opt, "198.51.100.1"},
+		{"10.0.0.1:1234", http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, opt, "10.0.0.3"},
+		{"10.0.0.1:1234", http.Header{"X-Real-Ip": {"198.51.100.2"}}, opt, "198.51.100.2"},
+		{"10.0.0.1:1234", nil, opt, "10.0.0.1"},
+	}
+	for _, test := range tests {
+		var ip string
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip = gear.G(r).ClientIP(test.opt)
+		})
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remote
+		r.Header = test.header
+		if r.Header == nil {
+			r.Header = http.Header{}
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if ip != test.want {
+			t.Fatal(test, ip)
+		}
+	}
+}
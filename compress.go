@@ -0,0 +1,231 @@
+package gear
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// EncoderFactory returns an encoder writing the compressed data to w.
+// The encoder is closed after the response is written.
+// If the encoder has a method Flush() error, it is called when the response is flushed.
+type EncoderFactory func(w io.Writer) io.WriteCloser
+
+// CompressOptions are options for [Compress]. A zero CompressOptions consists entirely of zero values.
+type CompressOptions struct {
+	// Encoders are the encoder factories keyed by content-coding, such as "br", "zstd" and "gzip".
+	// Brotli and zstd implementations are not provided by this package, add them here.
+	// Zero value means only "gzip" is supported, using [compress/gzip].
+	Encoders map[string]EncoderFactory
+	// Priority is the server preference of content-codings in Encoders, most preferred first,
+	// used to break ties of client preference. Codings not in Priority are the least preferred.
+	// Zero value means "br", "zstd", "gzip".
+	Priority []string
+	// SkipContentTypes are the media types, or prefixes of them ending with "/", which are not compressed,
+	// because they are already compressed.
+	// Zero value means "image/"(except "image/svg+xml"), "video/", "audio/", "font/woff", "font/woff2",
+	// "application/zip", "application/gzip", "application/x-gzip", "application/zstd" and "application/octet-stream".
+	SkipContentTypes []string
+}
+
+// defaultCompressPriority is the default value of [CompressOptions].Priority.
+var defaultCompressPriority = []string{"br", "zstd", "gzip"}
+
+// defaultCompressSkip is the default value of [CompressOptions].SkipContentTypes.
+var defaultCompressSkip = []string{"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd", "application/octet-stream"}
+
+// skipCompress returns whether the content type ct should not be compressed.
+func skipCompress(ct string, skip []string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	if mediaType == "image/svg+xml" {
+		return false
+	}
+	for _, s := range skip {
+		if mediaType == s || (strings.HasSuffix(s, "/") && strings.HasPrefix(mediaType, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding returns the content-coding in priority to use for the Accept-Encoding header value accept,
+// or "" if there is none acceptable.
+// The coding with the highest quality value wins, and ties are broken by the order in priority.
+func negotiateEncoding(accept string, priority []string) string {
+	var qualities = make(map[string]float64)
+	for _, item := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		var q = 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				q = f
+			}
+		}
+		qualities[coding] = q
+	}
+	var best string
+	var bestQ float64
+	for _, coding := range priority {
+		q, ok := qualities[coding]
+		if !ok {
+			q = qualities["*"]
+		}
+		if q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter is a http.ResponseWriter which compresses the body.
+// Whether to compress is decided when the body is first written, by then the content type is known.
+type compressWriter struct {
+	http.ResponseWriter
+	coding     string
+	factory    EncoderFactory
+	skip       []string
+	statusCode int            // Status code to write, 0 if WriteHeader has not been called.
+	decided    bool           // Whether the header has been written.
+	enc        io.WriteCloser // Non-nil if compressing.
+}
+
+// decide decides whether to compress and writes the header. p is the first data to write.
+func (w *compressWriter) decide(p []byte) {
+	w.decided = true
+	var header = w.Header()
+	var ct = header.Get("Content-Type")
+	if ct == "" && len(p) > 0 {
+		ct = http.DetectContentType(p)
+		header.Set("Content-Type", ct)
+	}
+	if header.Get("Content-Encoding") == "" && len(p) > 0 && !isEventStream(header) &&
+		w.statusCode != http.StatusNoContent && w.statusCode != http.StatusNotModified &&
+		!skipCompress(ct, w.skip) {
+		header.Set("Content-Encoding", w.coding)
+		header.Del("Content-Length")
+		w.enc = w.factory(w.ResponseWriter)
+	}
+	if w.statusCode != 0 {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+	}
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.decided || (statusCode >= 100 && statusCode < 200) {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+// Write implements [http.ResponseWriter].
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.decide(p)
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements [http.Flusher].
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(nil)
+	}
+	if flusher, ok := w.enc.(interface{ Flush() error }); ok {
+		LogIfErr(flusher.Flush())
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, see [http.ResponseController].
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close writes the pending header if any and closes the encoder.
+func (w *compressWriter) close() error {
+	if !w.decided {
+		w.decide(nil)
+	}
+	if w.enc != nil {
+		return w.enc.Close()
+	}
+	return nil
+}
+
+// Compress returns a [Middleware] which compresses the response body.
+// The content-coding is negotiated from Accept-Encoding header of the request by client preference,
+// and server priority(see [CompressOptions]) if the client has no preference.
+// Vary header is set to Accept-Encoding. Responses already having a Content-Encoding header,
+// without a body, or of content types already compressed are not compressed.
+// WebSocket upgrades and server-sent event streams are not compressed either,
+// see [Gear.IsWebSocket] and [Gear.IsEventStream].
+// If opt is nil, the default options are used.
+func Compress(opt *CompressOptions) Middleware {
+	var encoders = map[string]EncoderFactory{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	}
+	var priority = defaultCompressPriority
+	var skip = defaultCompressSkip
+	if opt != nil {
+		if opt.Encoders != nil {
+			encoders = opt.Encoders
+		}
+		if opt.Priority != nil {
+			priority = opt.Priority
+		}
+		if opt.SkipContentTypes != nil {
+			skip = opt.SkipContentTypes
+		}
+	}
+	// Supported codings in order of priority.
+	var codings = make([]string, 0, len(encoders))
+	for _, coding := range priority {
+		if encoders[coding] != nil && !slices.Contains(codings, coding) {
+			codings = append(codings, coding)
+		}
+	}
+	var rest []string
+	for coding := range encoders {
+		if !slices.Contains(codings, coding) {
+			rest = append(rest, coding)
+		}
+	}
+	slices.Sort(rest)
+	codings = append(codings, rest...)
+
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		g.W.Header().Add("Vary", "Accept-Encoding")
+		var coding = negotiateEncoding(g.R.Header.Get("Accept-Encoding"), codings)
+		if coding == "" || g.R.Method == http.MethodHead || g.IsWebSocket() {
+			next(g)
+			return
+		}
+		var w = g.W
+		var cw = &compressWriter{ResponseWriter: w, coding: coding, factory: encoders[coding], skip: skip}
+		g.W = cw
+		defer func() {
+			g.W = w
+			LogIfErr(cw.close())
+		}()
+		next(g)
+	}, "Compress")
+}
@@ -0,0 +1,113 @@
+package gear_test
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+// prefixEncoder is a fake encoder writing a prefix before the data.
+type prefixEncoder struct {
+	w      io.Writer
+	prefix string
+}
+
+func (e *prefixEncoder) Write(p []byte) (int, error) {
+	if e.prefix != "" {
+		if _, err := io.WriteString(e.w, e.prefix); err != nil {
+			return 0, err
+		}
+		e.prefix = ""
+	}
+	return e.w.Write(p)
+}
+
+func (e *prefixEncoder) Close() error { return nil }
+
+func TestCompress(t *testing.T) {
+	var encoders = map[string]gear.EncoderFactory{
+		"br":   func(w io.Writer) io.WriteCloser { return &prefixEncoder{w, "br:"} },
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	}
+	var tests = []struct {
+		opt      *gear.CompressOptions
+		accept   string
+		ct       string
+		encoding string
+		body     string
+	}{
+		{nil, "gzip, br", "", "gzip", "hello"},
+		{nil, "", "", "", "hello"},
+		{nil, "gzip;q=0", "", "", "hello"},
+		{nil, "gzip", "image/png", "", "hello"},
+		{&gear.CompressOptions{Encoders: encoders}, "gzip, br", "", "br", "br:hello"},
+		{&gear.CompressOptions{Encoders: encoders}, "gzip, br;q=0.5", "", "gzip", "hello"},
+		{&gear.CompressOptions{Encoders: encoders, Priority: []string{"gzip", "br"}}, "*", "", "gzip", "hello"},
+	}
+	for _, test := range tests {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			if test.ct != "" {
+				w.Header().Set("Content-Type", test.ct)
+			}
+			io.WriteString(w, "hello")
+		}, gear.Compress(test.opt))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.accept != "" {
+			r.Header.Set("Accept-Encoding", test.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("Content-Encoding") != test.encoding {
+			t.Fatal(test, w.Header())
+		}
+		var body io.Reader = w.Body
+		if test.encoding == "gzip" {
+			gz, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = gz
+		}
+		var b strings.Builder
+		if _, err := io.Copy(&b, body); err != nil || b.String() != test.body {
+			t.Fatal(test, b.String(), err)
+		}
+	}
+}
+
+func TestCompressStreaming(t *testing.T) {
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		if gear.G(r).IsWebSocket() {
+			w.WriteHeader(http.StatusSwitchingProtocols)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		if !gear.G(r).IsEventStream() {
+			t.Fatal()
+		}
+		io.WriteString(w, "data: 1\n\n")
+	}, gear.Compress(nil))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "data: 1\n\n" {
+		t.Fatal(w.Header(), w.Body.String())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusSwitchingProtocols || w.Header().Get("Content-Encoding") != "" {
+		t.Fatal(w.Code, w.Header())
+	}
+}
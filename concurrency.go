@@ -0,0 +1,117 @@
+package gear
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyOptions are options for [ConcurrencyWithOptions].
+// A zero ConcurrencyOptions consists entirely of zero values.
+type ConcurrencyOptions struct {
+	// Wait is the maximum duration a request waits for a slot when the limit is reached, before it is rejected.
+	// Zero value means the request is rejected immediately.
+	Wait time.Duration
+	// RetryAfter is the value of Retry-After header of the rejected responses, rounded up to seconds.
+	// Zero value means 1 second.
+	RetryAfter time.Duration
+	// Key returns the key of the limit for r. Requests with different keys are limited separately,
+	// so the number of distinct keys should be bounded, route patterns for example.
+	// Zero value means all the requests share a single limit.
+	Key func(r *http.Request) string
+}
+
+// concurrencyLimiter is the [Middleware] returned by [ConcurrencyWithOptions].
+type concurrencyLimiter struct {
+	max        int
+	wait       time.Duration
+	retryAfter string
+	key        func(r *http.Request) string
+
+	mu   sync.Mutex
+	sems map[string]chan struct{} // Semaphores keyed by the key of limit.
+}
+
+// sem returns the semaphore of key.
+func (l *concurrencyLimiter) sem(key string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sem := l.sems[key]
+	if sem == nil {
+		sem = make(chan struct{}, l.max)
+		l.sems[key] = sem
+	}
+	return sem
+}
+
+// acquire acquires a slot of sem, waiting at most l.wait, and returns whether it succeeds.
+func (l *concurrencyLimiter) acquire(g *Gear, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+	if l.wait <= 0 {
+		return false
+	}
+	var timer = time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-g.Done():
+		return false
+	}
+}
+
+// Serve implements [Middleware].
+func (l *concurrencyLimiter) Serve(g *Gear, next func(*Gear)) {
+	var key string
+	if l.key != nil {
+		key = l.key(g.R)
+	}
+	var sem = l.sem(key)
+	if !l.acquire(g, sem) {
+		g.W.Header().Set("Retry-After", l.retryAfter)
+		g.Code(http.StatusServiceUnavailable)
+		g.Stop()
+		return
+	}
+	defer func() { <-sem }() // Released even if next panics.
+	next(g)
+}
+
+// MiddlewareName implements [MiddlewareName].
+func (l *concurrencyLimiter) MiddlewareName() string {
+	return "Concurrency"
+}
+
+// Concurrency returns a [Middleware] which limits the number of in-flight requests to max.
+// The requests arrive when the limit is reached get a http.StatusServiceUnavailable response
+// with Retry-After header immediately, instead of being queued unbounded, which protects backends
+// with limited resources, such as database connections, from overload.
+// Concurrency panics if max is not positive.
+func Concurrency(max int) Middleware {
+	return ConcurrencyWithOptions(max, nil)
+}
+
+// ConcurrencyWithOptions is like [Concurrency] but the waiting, Retry-After header and per-key limits
+// are customized by opt. If opt is nil, the default options are used.
+func ConcurrencyWithOptions(max int, opt *ConcurrencyOptions) Middleware {
+	if max <= 0 {
+		panic(errors.New("gear: non-positive concurrency limit"))
+	}
+	var l = &concurrencyLimiter{max: max, retryAfter: "1", sems: make(map[string]chan struct{})}
+	if opt != nil {
+		l.wait = opt.Wait
+		if opt.RetryAfter > 0 {
+			l.retryAfter = strconv.FormatInt(int64((opt.RetryAfter+time.Second-1)/time.Second), 10)
+		}
+		l.key = opt.Key
+	}
+	return l
+}
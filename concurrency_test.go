@@ -0,0 +1,68 @@
+package gear_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mkch/gear"
+)
+
+func TestConcurrency(t *testing.T) {
+	var release = make(chan struct{})
+	var entered = make(chan struct{})
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("oops")
+		}
+		entered <- struct{}{}
+		<-release
+	}, gear.ConcurrencyWithOptions(1, &gear.ConcurrencyOptions{RetryAfter: 1500 * time.Millisecond}), gear.PanicRecovery(false))
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serve("/")
+	}()
+	<-entered
+	if w := serve("/"); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Fatal(w.Code, w.Header())
+	}
+	close(release)
+	wg.Wait()
+
+	// The slot is released even if the handler panics.
+	withLogger(slog.New(slog.NewTextHandler(io.Discard, nil)), func() { serve("/panic") })
+	go func() { <-entered }()
+	if w := serve("/"); w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+}
+
+func TestConcurrencyWait(t *testing.T) {
+	var release = make(chan struct{})
+	var entered = make(chan struct{}, 1)
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}, gear.ConcurrencyWithOptions(1, &gear.ConcurrencyOptions{Wait: time.Second}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-entered
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package gear
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+
+	"github.com/mkch/gg"
+)
+
+// DefaultDumpMaxBodySize is the default maximum number of body bytes dumped by [Dump].
+const DefaultDumpMaxBodySize = 4096
+
+// DumpOptions are options for [Dump]. A zero DumpOptions consists entirely of zero values.
+type DumpOptions struct {
+	// MaxBodySize is the maximum number of bytes dumped for request body and response body respectively.
+	// Negative value means bodies are not dumped.
+	// Zero value means DefaultDumpMaxBodySize.
+	MaxBodySize int
+}
+
+// Dump returns a [Middleware] which dumps the request and response to w for debugging.
+// The request method, URL, headers and body are dumped before the request is handled,
+// and the response status, headers and body after.
+// Bodies longer than the maximum size(see [DumpOptions]) are truncated in the dump,
+// but the handler and the client are unaffected.
+// If opt is nil, the default options are used.
+//
+// Dump is meant for development only, it may expose sensitive data such as credentials.
+func Dump(w io.Writer, opt *DumpOptions) Middleware {
+	var maxBody = DefaultDumpMaxBodySize
+	if opt != nil && opt.MaxBodySize != 0 {
+		maxBody = opt.MaxBodySize
+	}
+	var mu sync.Mutex // Serializes writing to w.
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var buf bytes.Buffer
+		if reqDump, err := httputil.DumpRequest(g.R, false); LogIfErr(err) == nil {
+			buf.WriteString(">>> ")
+			buf.Write(reqDump)
+		}
+		if maxBody > 0 && g.R.Body != nil && g.R.Body != http.NoBody {
+			// Dump at most maxBody+1 bytes(to tell truncation) and put them back.
+			var body = g.R.Body
+			prefix, err := io.ReadAll(io.LimitReader(body, int64(maxBody)+1))
+			LogIfErr(err)
+			g.R.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(prefix), body), body}
+			writeDumpBody(&buf, prefix, maxBody)
+		}
+
+		var rw = g.W
+		var cw = newCaptureWriter(rw, gg.If(maxBody > 0, maxBody+1, 0))
+		g.W = cw
+		defer func() { g.W = rw }()
+		next(g)
+
+		var status = cw.status()
+		fmt.Fprintf(&buf, "<<< %v %v %v\r\n", g.R.Proto, status, http.StatusText(status))
+		LogIfErr(rw.Header().Write(&buf))
+		buf.WriteString("\r\n")
+		if maxBody > 0 {
+			writeDumpBody(&buf, cw.body.Bytes(), maxBody)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		LogIfErrT(buf.WriteTo(w))
+	}, "Dump")
+}
+
+// writeDumpBody writes at most maxBody bytes of body to buf.
+func writeDumpBody(buf *bytes.Buffer, body []byte, maxBody int) {
+	if len(body) == 0 {
+		return
+	}
+	if len(body) > maxBody {
+		buf.Write(body[:maxBody])
+		buf.WriteString("\n... (truncated)")
+	} else {
+		buf.Write(body)
+	}
+	buf.WriteString("\n")
+}
@@ -0,0 +1,47 @@
+package gear_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gear/internal/geartest"
+)
+
+func TestDump(t *testing.T) {
+	var buf bytes.Buffer
+	var reqBody string
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		reqBody = string(body)
+		w.Header().Set("X-Resp", "v")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "response body")
+	})
+	server := gear.NewTestServer(&mux, gear.Dump(&buf, &gear.DumpOptions{MaxBodySize: 8}))
+	defer server.Close()
+
+	if body, _ := geartest.CurlPOST(server.URL+"/a?b=c", "text/plain", "request body"); string(body) != "response body" {
+		t.Fatal(string(body))
+	}
+	if reqBody != "request body" {
+		t.Fatal(reqBody)
+	}
+	dump := buf.String()
+	for _, s := range []string{
+		">>> POST /a?b=c HTTP/1.1\r\n",
+		"Content-Type: text/plain\r\n",
+		"\r\n\r\nrequest \n... (truncated)\n",
+		"<<< HTTP/1.1 202 Accepted\r\n",
+		"X-Resp: v\r\n",
+		"\r\n\r\nresponse\n... (truncated)\n",
+	} {
+		if !strings.Contains(dump, s) {
+			t.Fatalf("%q not in\n%v", s, dump)
+		}
+	}
+}
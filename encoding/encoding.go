@@ -1,12 +1,18 @@
 package encoding
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
 
 	"github.com/mkch/gear/validator"
 )
@@ -28,7 +34,11 @@ func (f BodyDecoderFunc) DecodeBody(body io.Reader, v any) error {
 }
 
 // JSONBodyDecoder decodes body as JSON object.
+// Interface fields can be decoded with the factories registered by [RegisterInterface].
 var JSONBodyDecoder BodyDecoder = BodyDecoderFunc(func(body io.Reader, v any) error {
+	if len(interfaceFactories) > 0 {
+		return decodeJSONInterfaces(body, v)
+	}
 	return json.NewDecoder(body).Decode(v)
 })
 
@@ -37,6 +47,95 @@ var XMLBodyDecoder BodyDecoder = BodyDecoderFunc(func(body io.Reader, v any) err
 	return xml.NewDecoder(body).Decode(v)
 })
 
+// ErrNoTOMLCodec is returned by [DecodeTOML] and [EncodeTOML] if no TOML codec is provided.
+var ErrNoTOMLCodec = errors.New("gear: no TOML codec, see encoding.DecodeTOML and encoding.EncodeTOML")
+
+// DecodeTOML reads the TOML document from r and stores the result in the value pointed to by v.
+// This package does not depend on any TOML implementation, DecodeTOML returns [ErrNoTOMLCodec]
+// until it is replaced. For example, with github.com/BurntSushi/toml:
+//
+//	encoding.DecodeTOML = func(r io.Reader, v any) error {
+//		_, err := toml.NewDecoder(r).Decode(v)
+//		return err
+//	}
+var DecodeTOML = func(r io.Reader, v any) error {
+	return ErrNoTOMLCodec
+}
+
+// TOMLBodyDecoder decodes body as TOML document using [DecodeTOML].
+var TOMLBodyDecoder BodyDecoder = BodyDecoderFunc(func(body io.Reader, v any) error {
+	return DecodeTOML(body, v)
+})
+
+// FormMaxBodySize is the maximum number of bytes of an application/x-www-form-urlencoded body
+// read by [FormBodyDecoder], the same as the limit of [http.Request.ParseForm].
+var FormMaxBodySize int64 = 10 << 20
+
+// ErrFormBodyTooLarge is returned by [FormBodyDecoder] if the body is larger than [FormMaxBodySize].
+var ErrFormBodyTooLarge = errors.New("gear: form body too large")
+
+// FormBodyDecoder decodes body as application/x-www-form-urlencoded form using [FormDecoder].
+// At most [FormMaxBodySize] bytes are read, and [ErrFormBodyTooLarge] is returned if the body is larger.
+var FormBodyDecoder BodyDecoder = BodyDecoderFunc(func(body io.Reader, v any) error {
+	var max = FormMaxBodySize
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > max {
+		return ErrFormBodyTooLarge
+	}
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return FormDecoder.DecodeMap(values, v)
+})
+
+// ContentTypeBodyDecoder is implemented by [BodyDecoder]s which need the Content-Type header of the request,
+// such as the boundary parameter of multipart body. [DecodeBody] calls DecodeBodyContentType of them instead of DecodeBody.
+type ContentTypeBodyDecoder interface {
+	BodyDecoder
+	// DecodeBodyContentType is like DecodeBody, but contentType is the value of Content-Type header of the request.
+	DecodeBodyContentType(body io.Reader, contentType string, v any) error
+}
+
+// MultipartMaxMemory is the maximum number of bytes of a multipart body stored in memory by [MultipartBodyDecoder],
+// the remainder is stored on disk in temporary files, which are removed after decoding.
+var MultipartMaxMemory int64 = 32 << 20
+
+// multipartBodyDecoder is the type of [MultipartBodyDecoder].
+type multipartBodyDecoder struct{}
+
+// DecodeBody implements [BodyDecoder]. It always returns [http.ErrMissingBoundary],
+// because the boundary is in the Content-Type header, see [ContentTypeBodyDecoder].
+func (multipartBodyDecoder) DecodeBody(body io.Reader, v any) error {
+	return http.ErrMissingBoundary
+}
+
+// DecodeBodyContentType implements [ContentTypeBodyDecoder].
+func (multipartBodyDecoder) DecodeBodyContentType(body io.Reader, contentType string, v any) error {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return http.ErrMissingBoundary
+	}
+	form, err := multipart.NewReader(body, boundary).ReadForm(MultipartMaxMemory)
+	if err != nil {
+		return err
+	}
+	defer form.RemoveAll()
+	return FormDecoder.DecodeMap(form.Value, v)
+}
+
+// MultipartBodyDecoder decodes the non-file parts of multipart/form-data body using [FormDecoder].
+// The file parts are skipped, use [http.Request.FormFile] to access them.
+// See [MultipartMaxMemory] for the memory limit.
+var MultipartBodyDecoder BodyDecoder = multipartBodyDecoder{}
+
 // UnknownMIMEError is returned by [DecodeBody] if there is no such [BodyDecoder]
 // matching MIME of the request body.
 type UnknownMIMEError string
@@ -46,38 +145,136 @@ func (err UnknownMIMEError) Error() string {
 }
 
 // DecodeBody decodes r.Body using decoder and stores the result in the value pointed to by v.
-// If decoder is nil, Content-Type header of r will be used to select an appropriate decoder
-// from the built-in decoders and  decoders registered by [RegisterBodyDecoder].
-// If there is no decoder for that type, [UnknownMIMEError] error is returned.
-// See [BodyDecoder] for details.
+// If decoder is nil, it is selected by [BodyDecoderSelector], which by default uses Content-Type header of r
+// to select an appropriate decoder from the built-in decoders and  decoders registered by [RegisterBodyDecoder].
+// The media type without parameters is used if there is no decoder for the whole header value.
+// If there is no decoder for that type, [DefaultBodyDecoder] is used if not nil,
+// otherwise [UnknownMIMEError] error is returned.
+// See [BodyDecoder] and [ContentTypeBodyDecoder] for details.
 func DecodeBody(r *http.Request, decoder BodyDecoder, v any) (err error) {
 	if decoder == nil {
-		decoder, err = selectBodyDecoder(r)
+		decoder, err = BodyDecoderSelector(r)
 		if err != nil {
 			return
 		}
 	}
+	if d, ok := decoder.(ContentTypeBodyDecoder); ok {
+		contentType := r.Header.Get("Content-Type")
+		return validate[io.Reader](func(body io.Reader, v any) error {
+			return d.DecodeBodyContentType(body, contentType, v)
+		}, r.Body, v)
+	}
 	return validate[io.Reader](decoder.DecodeBody, r.Body, v)
 }
 
+// DecodeJSONPatch decodes body as a JSON object and stores the result in the value pointed to by v,
+// and returns the set of the top-level keys present in the object.
+// It is useful for PATCH requests to tell fields absent from fields set to zero values.
+// The result is not validated, because fields required in a full object may be absent.
+func DecodeJSONPatch(body io.Reader, v any) (present map[string]bool, err error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return
+	}
+	present = make(map[string]bool, len(fields))
+	for key := range fields {
+		present[key] = true
+	}
+	return
+}
+
+// ErrNoDiscriminator is returned by [DecodeDiscriminated] if the discriminator field
+// is absent from the JSON object or is not a string.
+var ErrNoDiscriminator = errors.New("gear: no discriminator field")
+
+// UnknownDiscriminatorError is returned by [DecodeDiscriminated] if there is no
+// factory registered for the discriminator value.
+type UnknownDiscriminatorError string
+
+func (err UnknownDiscriminatorError) Error() string {
+	return fmt.Sprintf("unknown discriminator %q", string(err))
+}
+
+// DecodeDiscriminated decodes body as a JSON object whose concrete type is determined by
+// the string value of field. The value selects a factory in registry, which returns a pointer to
+// a new value of the concrete type. The whole object is then decoded into it, and the pointer is returned
+// after validation. For example:
+//
+//	v, err := encoding.DecodeDiscriminated(body, "type", map[string]func() any{
+//		"click":  func() any { return &ClickEvent{} },
+//		"scroll": func() any { return &ScrollEvent{} },
+//	})
+//
+// If field is absent, [ErrNoDiscriminator] is returned; if there is no factory for the value,
+// [UnknownDiscriminatorError] is returned.
+func DecodeDiscriminated(body io.Reader, field string, registry map[string]func() any) (v any, err error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return
+	}
+	var discriminator string
+	if raw, ok := fields[field]; !ok || json.Unmarshal(raw, &discriminator) != nil {
+		return nil, ErrNoDiscriminator
+	}
+	factory, ok := registry[discriminator]
+	if !ok {
+		return nil, UnknownDiscriminatorError(discriminator)
+	}
+	v = factory()
+	if err = validate(json.Unmarshal, data, v); err != nil {
+		return nil, err
+	}
+	return
+}
+
 const (
-	MIME_JSON     = "application/json"
-	MIME_XML      = "application/xml"
-	MIME_TEXT_XML = "text/xml"
+	MIME_JSON       = "application/json"
+	MIME_XML        = "application/xml"
+	MIME_TEXT_XML   = "text/xml"
+	MIME_TOML       = "application/toml"
+	MIME_TEXT_TOML  = "text/toml"
+	MIME_PROTOBUF   = "application/protobuf"
+	MIME_X_PROTOBUF = "application/x-protobuf"
+	MIME_FORM       = "application/x-www-form-urlencoded"
+	MIME_MULTIPART  = "multipart/form-data"
+	MIME_NDJSON     = "application/x-ndjson"
+	// MIME_PROBLEM_JSON is the media type of RFC 7807 problem details.
+	MIME_PROBLEM_JSON = "application/problem+json"
 )
 
 // key is the content type.
 var bodyDecoders = map[string]BodyDecoder{
-	MIME_JSON:     JSONBodyDecoder,
-	MIME_XML:      XMLBodyDecoder,
-	MIME_TEXT_XML: XMLBodyDecoder,
+	MIME_JSON:       JSONBodyDecoder,
+	MIME_XML:        XMLBodyDecoder,
+	MIME_TEXT_XML:   XMLBodyDecoder,
+	MIME_TOML:       TOMLBodyDecoder,
+	MIME_TEXT_TOML:  TOMLBodyDecoder,
+	MIME_PROTOBUF:   ProtobufBodyDecoder,
+	MIME_X_PROTOBUF: ProtobufBodyDecoder,
+	MIME_FORM:       FormBodyDecoder,
+	MIME_MULTIPART:  MultipartBodyDecoder,
+	MIME_NDJSON:     NDJSONBodyDecoder,
 }
 
 // RegisterBodyDecoder registers decoder for mime, previous
 // decoder(if any) of mime will be overwritten.
 // This package registers [JSONBodyDecoder] for [MIME_JSON],
-// and [XMLBodyDecoder] for [MIME_XML] and [MIME_TEXT_XML]
-// in package initialization.
+// [XMLBodyDecoder] for [MIME_XML] and [MIME_TEXT_XML],
+// [TOMLBodyDecoder] for [MIME_TOML] and [MIME_TEXT_TOML],
+// [ProtobufBodyDecoder] for [MIME_PROTOBUF] and [MIME_X_PROTOBUF],
+// [FormBodyDecoder] for [MIME_FORM], [MultipartBodyDecoder] for [MIME_MULTIPART],
+// and [NDJSONBodyDecoder] for [MIME_NDJSON] in package initialization.
 // [DecodeBody] selects an appropriate decoder from the registered
 // decoders to decode the request body.
 //
@@ -86,18 +283,77 @@ func RegisterBodyDecoder(mime string, decoder BodyDecoder) {
 	bodyDecoders[mime] = decoder
 }
 
-// selectBodyDecoder returns an decoder from bodyDecoders which can decode the
-// body of r. The selection is made by Content-Type header.
-func selectBodyDecoder(r *http.Request) (decoder BodyDecoder, err error) {
-	mime := r.Header.Get("Content-Type")
-	if decoder = bodyDecoders[mime]; decoder == nil {
-		err = UnknownMIMEError(mime)
+// RegisteredBodyDecoders returns the sorted content types of all the registered decoders,
+// including the built-in ones. See [RegisterBodyDecoder].
+//
+// It's safe to call RegisteredBodyDecoders concurrently with [DecodeBody], but like DecodeBody,
+// it's not safe to call it concurrently with [RegisterBodyDecoder].
+func RegisteredBodyDecoders() []string {
+	var mimes = make([]string, 0, len(bodyDecoders))
+	for mime := range bodyDecoders {
+		mimes = append(mimes, mime)
+	}
+	slices.Sort(mimes)
+	return mimes
+}
+
+// DefaultBodyDecoder is the decoder used by [DecodeBody] if Content-Type header of the request
+// is empty or there is no decoder registered for it.
+// If DefaultBodyDecoder is nil, which is the default, [UnknownMIMEError] is returned in such cases.
+// Lenient APIs can set it to [JSONBodyDecoder] to accept JSON bodies without Content-Type header.
+//
+// It's not safe to set DefaultBodyDecoder concurrently with [DecodeBody].
+var DefaultBodyDecoder BodyDecoder
+
+// BodyDecoderSelector selects the decoder used by [DecodeBody] to decode the body of r when
+// no decoder is specified. Applications can replace it to implement custom rules, such as
+// handling vendor media types or inspecting the body, and fall back to [SelectBodyDecoder],
+// the default, for the requests they don't handle. For example:
+//
+//	encoding.BodyDecoderSelector = func(r *http.Request) (encoding.BodyDecoder, error) {
+//		if strings.HasSuffix(r.Header.Get("Content-Type"), "+json") {
+//			return encoding.JSONBodyDecoder, nil
+//		}
+//		return encoding.SelectBodyDecoder(r)
+//	}
+//
+// It's not safe to set BodyDecoderSelector concurrently with [DecodeBody].
+var BodyDecoderSelector func(r *http.Request) (BodyDecoder, error) = SelectBodyDecoder
+
+// SelectBodyDecoder is the default [BodyDecoderSelector]. It returns a decoder registered
+// by [RegisterBodyDecoder] which can decode the body of r. The selection is made by Content-Type
+// header, or the media type of it without parameters if there is no decoder for the whole header value.
+// [DefaultBodyDecoder], if not nil, is returned if no decoder matches, otherwise [UnknownMIMEError] is returned.
+func SelectBodyDecoder(r *http.Request) (decoder BodyDecoder, err error) {
+	ct := r.Header.Get("Content-Type")
+	if decoder = bodyDecoders[ct]; decoder != nil {
+		return
+	}
+	if mediaType, _, err := mime.ParseMediaType(ct); err == nil {
+		if decoder = bodyDecoders[mediaType]; decoder != nil {
+			return decoder, nil
+		}
+	}
+	if decoder = DefaultBodyDecoder; decoder == nil {
+		err = UnknownMIMEError(ct)
 	}
 	return
 }
 
 // EncodeJSON writes the JSON encoding of v to the stream w.
+// v is encoded into a buffer first, and nothing is written to w if the encoding fails.
 var EncodeJSON = func(v any, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// EncodeJSONStream writes the JSON encoding of v to the stream w without buffering.
+// It is suitable for large payloads, but partial data may have been written to w if the encoding fails.
+var EncodeJSONStream = func(v any, w io.Writer) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
@@ -106,24 +362,76 @@ var EncodeXML = func(v any, w io.Writer) error {
 	return xml.NewEncoder(w).Encode(v)
 }
 
+// EncodeTOML writes the TOML encoding of v to the stream w.
+// Like [DecodeTOML], EncodeTOML returns [ErrNoTOMLCodec] until it is replaced.
+var EncodeTOML = func(v any, w io.Writer) error {
+	return ErrNoTOMLCodec
+}
+
+// PostDecoder is the interface implemented by types that post-process themselves after decoding,
+// such as trimming strings, lowercasing emails or computing derived fields.
+// [DecodeBody], [DecodeForm], [DecodeHeader], [DecodeQuery] and [DecodeDiscriminated] call
+// PostDecode of the decoded value after a successful decoding and before validation.
+// The error returned by PostDecode, if any, is returned by the decoding function.
+type PostDecoder interface {
+	PostDecode() error
+}
+
 // validate calls decode(src, dest) first, if it returns an error, validate returns it.
-// Otherwise the return value of validating dest is returned, but an
-// *validator.InvalidValidationError is considered as nil.
+// Then dest is post-processed if it implements [PostDecoder].
+// Otherwise the return value of validating dest is returned, see [validateValue].
 func validate[T any](decode func(T, any) error, src T, dest any) (err error) {
 	err = decode(src, dest)
 	if err != nil {
 		return
 	}
-	var invalid *validator.InvalidValidationError
-	var validated bool
-	if validated, err = validator.Struct(dest); !validated {
-		return nil
-	} else if errors.As(err, &invalid) {
-		// InvalidValidationError means dest can't be validated by the validator.
-		// Leave it alone.
+	if p, ok := dest.(PostDecoder); ok {
+		if err = p.PostDecode(); err != nil {
+			return
+		}
+	}
+	return validateValue(reflect.ValueOf(dest))
+}
+
+// validateValue validates v with the registered validator.
+// Pointers and interfaces are dereferenced, and the elements of slices, arrays and maps
+// are validated one by one, so a JSON array of objects is validated the same way as
+// a single object. Scalars can't be validated and are considered valid.
+// An *validator.InvalidValidationError is considered as nil.
+func validateValue(v reflect.Value) error {
+	if !validator.Registered() {
 		return nil
 	}
-	return
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		_, err := validator.Struct(v.Interface())
+		var invalid *validator.InvalidValidationError
+		if errors.As(err, &invalid) {
+			// InvalidValidationError means v can't be validated by the validator.
+			// Leave it alone.
+			return nil
+		}
+		return err
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateValue(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for iter := v.MapRange(); iter.Next(); {
+			if err := validateValue(iter.Value()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // validateMap validates url.Values or http.Header.
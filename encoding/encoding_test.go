@@ -1,16 +1,21 @@
 package encoding_test
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/mkch/gear"
 	"github.com/mkch/gear/encoding"
 	"github.com/mkch/gear/internal/geartest"
+	"github.com/mkch/gg"
 )
 
 func TestDefaultFormDecoder(t *testing.T) {
@@ -108,3 +113,466 @@ func TestCustomDecoder(t *testing.T) {
 	defer server.Close()
 	geartest.CurlPOST(server.URL, encoding.MIME_JSON, `{}`, "-w", "\n%{http_code}")
 }
+
+func TestCollectErrors(t *testing.T) {
+	var values = url.Values{
+		"A": []string{"a"},
+		"B": []string{"1"},
+		"C": []string{"c"},
+	}
+	type S struct {
+		A int
+		B int
+		C float64
+	}
+
+	var s S
+	err := encoding.FormDecoder.DecodeMap(values, &s)
+	var fieldErr *encoding.DecodeFieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Name != "A" {
+		t.Fatal(err)
+	}
+
+	s = S{}
+	err = encoding.NewMapDecoder(&encoding.MapDecoderOptions{CollectErrors: true}).DecodeMap(values, &s)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range joined.Unwrap() {
+		if !errors.As(e, &fieldErr) {
+			t.Fatal(e)
+		}
+		names = append(names, fieldErr.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"A", "C"}) {
+		t.Fatal(names)
+	}
+	if s.B != 1 {
+		t.Fatal(s)
+	}
+
+	if err = encoding.NewMapDecoder(&encoding.MapDecoderOptions{CollectErrors: true}).DecodeMap(url.Values{"B": []string{"2"}}, &s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndexedKeys(t *testing.T) {
+	var values = url.Values{
+		"items[2].name": []string{"c"},
+		"items[0].name": []string{"a"},
+		"items[0].n":    []string{"1"},
+		"items[10].n":   []string{"10"},
+		"tags[1]":       []string{"y"},
+		"tags[0]":       []string{"x"},
+		"tags[x]":       []string{"ignored"},
+		"ptrs[0].name":  []string{"p"},
+		"plain":         []string{"1", "2"},
+	}
+	type Item struct {
+		Name string `map:"name"`
+		N    int    `map:"n"`
+	}
+	type S struct {
+		Items []Item   `map:"items"`
+		Tags  []string `map:"tags"`
+		Ptrs  []*Item  `map:"ptrs"`
+		Plain []int    `map:"plain"`
+	}
+	var s S
+	decoder := encoding.NewMapDecoder(&encoding.MapDecoderOptions{IndexedKeys: true})
+	if err := decoder.DecodeMap(values, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, S{
+		Items: []Item{{"a", 1}, {"c", 0}, {"", 10}},
+		Tags:  []string{"x", "y"},
+		Ptrs:  []*Item{{Name: "p"}},
+		Plain: []int{1, 2},
+	}) {
+		t.Fatal(s)
+	}
+
+	var fieldErr *encoding.DecodeFieldError
+	if err := decoder.DecodeMap(url.Values{"items[3].n": []string{"x"}}, &s); !errors.As(err, &fieldErr) || fieldErr.Name != "Items[3].N" {
+		t.Fatal(err)
+	}
+}
+
+func TestEmptyAsNil(t *testing.T) {
+	var values = url.Values{
+		"age":   []string{""},
+		"tags":  []string{""},
+		"name":  []string{""},
+		"score": []string{"0"},
+	}
+	type S struct {
+		Age   *int     `map:"age"`
+		Tags  []string `map:"tags"`
+		Name  *string  `map:"name"`
+		Score *int     `map:"score"`
+	}
+	var s S
+	decoder := encoding.NewMapDecoder(&encoding.MapDecoderOptions{EmptyAsNil: true})
+	if err := decoder.DecodeMap(values, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Age != nil || s.Tags != nil || s.Name != nil || s.Score == nil || *s.Score != 0 {
+		t.Fatal(s)
+	}
+
+	if err := encoding.NewMapDecoder(nil).DecodeMap(url.Values{"name": []string{""}}, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name == nil || *s.Name != "" {
+		t.Fatal(s)
+	}
+}
+
+func TestLastValue(t *testing.T) {
+	var values = url.Values{
+		"n":    []string{"1", "2"},
+		"p":    []string{"a", "b"},
+		"tags": []string{"x", "y"},
+	}
+	type S struct {
+		N    int      `map:"n"`
+		P    *string  `map:"p"`
+		Tags []string `map:"tags"`
+	}
+	var s S
+	if err := encoding.NewMapDecoder(&encoding.MapDecoderOptions{LastValue: true}).DecodeMap(values, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.N != 2 || *s.P != "b" || !reflect.DeepEqual(s.Tags, []string{"x", "y"}) {
+		t.Fatal(s)
+	}
+	var m map[string]int
+	if err := encoding.NewMapDecoder(&encoding.MapDecoderOptions{LastValue: true}).DecodeMap(url.Values{"m": []string{"3", "4"}}, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["m"] != 4 {
+		t.Fatal(m)
+	}
+
+	s = S{}
+	if err := encoding.NewMapDecoder(nil).DecodeMap(values, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.N != 1 || *s.P != "a" {
+		t.Fatal(s)
+	}
+}
+
+func TestDelimTag(t *testing.T) {
+	var values = url.Values{
+		"ids":   []string{"1,2,3", "4"},
+		"names": []string{"a|b"},
+		"one":   []string{"x,y"},
+	}
+	type S struct {
+		IDs   []int     `map:"ids" delim:","`
+		Names *[]string `map:"names" delim:"|"`
+		One   string    `map:"one" delim:","`
+	}
+	var s S
+	if err := encoding.FormDecoder.DecodeMap(values, &s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, S{IDs: []int{1, 2, 3, 4}, Names: &[]string{"a", "b"}, One: "x,y"}) {
+		t.Fatal(s)
+	}
+}
+
+func TestDefaultBodyDecoder(t *testing.T) {
+	var v struct{ A int }
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader(`{"A":1}`)))
+	var unknown encoding.UnknownMIMEError
+	if err := encoding.DecodeBody(r, nil, &v); !errors.As(err, &unknown) {
+		t.Fatal(err)
+	}
+
+	encoding.DefaultBodyDecoder = encoding.JSONBodyDecoder
+	defer func() { encoding.DefaultBodyDecoder = nil }()
+	if err := encoding.DecodeBody(r, nil, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != 1 {
+		t.Fatal(v)
+	}
+}
+
+func TestBodyDecoderSelector(t *testing.T) {
+	var vendor = encoding.BodyDecoderFunc(func(body io.Reader, v any) error {
+		*v.(*string) = "vendor"
+		return nil
+	})
+	encoding.BodyDecoderSelector = func(r *http.Request) (encoding.BodyDecoder, error) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/vnd.") {
+			return vendor, nil
+		}
+		return encoding.SelectBodyDecoder(r)
+	}
+	defer func() { encoding.BodyDecoderSelector = encoding.SelectBodyDecoder }()
+
+	var v string
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader(`x`)))
+	r.Header.Set("Content-Type", "application/vnd.example+json")
+	if err := encoding.DecodeBody(r, nil, &v); err != nil || v != "vendor" {
+		t.Fatal(err, v)
+	}
+	var unknown encoding.UnknownMIMEError
+	r.Header.Set("Content-Type", "application/unknown")
+	if err := encoding.DecodeBody(r, nil, &v); !errors.As(err, &unknown) {
+		t.Fatal(err)
+	}
+}
+
+func TestTOMLBodyDecoder(t *testing.T) {
+	var v struct{ S string }
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader(`S = "str"`)))
+	r.Header.Set("Content-Type", encoding.MIME_TOML)
+	if err := encoding.DecodeBody(r, nil, &v); !errors.Is(err, encoding.ErrNoTOMLCodec) {
+		t.Fatal(err)
+	}
+
+	old := encoding.DecodeTOML
+	defer func() { encoding.DecodeTOML = old }()
+	encoding.DecodeTOML = func(r io.Reader, v any) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, value, _ := strings.Cut(string(data), " = ")
+		v.(*struct{ S string }).S = strings.Trim(value, `"`)
+		return nil
+	}
+	r.Header.Set("Content-Type", encoding.MIME_TEXT_TOML)
+	if err := encoding.DecodeBody(r, nil, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.S != "str" {
+		t.Fatal(v)
+	}
+}
+
+// fakeProto is a fake protobuf message.
+type fakeProto struct{ data string }
+
+func (m *fakeProto) Reset()         { m.data = "" }
+func (m *fakeProto) String() string { return m.data }
+func (m *fakeProto) ProtoMessage()  {}
+
+func TestProtobufBodyDecoder(t *testing.T) {
+	oldUnmarshal, oldMarshal := encoding.UnmarshalProtobuf, encoding.MarshalProtobuf
+	defer func() { encoding.UnmarshalProtobuf, encoding.MarshalProtobuf = oldUnmarshal, oldMarshal }()
+
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader("abc")))
+	r.Header.Set("Content-Type", encoding.MIME_X_PROTOBUF)
+	var m fakeProto
+	if err := encoding.DecodeBody(r, nil, &m); !errors.Is(err, encoding.ErrNoProtobufCodec) {
+		t.Fatal(err)
+	}
+	var notProto *encoding.NotProtoMessageError
+	if err := encoding.DecodeBody(r, nil, &struct{}{}); !errors.As(err, &notProto) {
+		t.Fatal(err)
+	}
+
+	encoding.UnmarshalProtobuf = func(data []byte, m encoding.ProtoMessage) error {
+		m.(*fakeProto).data = string(data)
+		return nil
+	}
+	encoding.MarshalProtobuf = func(m encoding.ProtoMessage) ([]byte, error) {
+		return []byte(m.String()), nil
+	}
+	r = gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader("abc")))
+	r.Header.Set("Content-Type", encoding.MIME_PROTOBUF)
+	if err := encoding.DecodeBody(r, nil, &m); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := encoding.EncodeProtobuf(&m, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "abc" {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestDecodeDiscriminated(t *testing.T) {
+	type Click struct {
+		Type string `json:"type"`
+		X, Y int
+	}
+	type Scroll struct {
+		Type  string `json:"type"`
+		Delta int
+	}
+	var registry = map[string]func() any{
+		"click":  func() any { return &Click{} },
+		"scroll": func() any { return &Scroll{} },
+	}
+	if v, err := encoding.DecodeDiscriminated(strings.NewReader(`{"type":"click","X":1,"Y":2}`), "type", registry); err != nil || !reflect.DeepEqual(v, &Click{"click", 1, 2}) {
+		t.Fatal(v, err)
+	}
+	if v, err := encoding.DecodeDiscriminated(strings.NewReader(`{"Delta":3,"type":"scroll"}`), "type", registry); err != nil || !reflect.DeepEqual(v, &Scroll{"scroll", 3}) {
+		t.Fatal(v, err)
+	}
+	if _, err := encoding.DecodeDiscriminated(strings.NewReader(`{"Delta":3}`), "type", registry); err != encoding.ErrNoDiscriminator {
+		t.Fatal(err)
+	}
+	if _, err := encoding.DecodeDiscriminated(strings.NewReader(`{"type":"key"}`), "type", registry); err != encoding.UnknownDiscriminatorError("key") {
+		t.Fatal(err)
+	}
+}
+
+func TestRegisteredBodyDecoders(t *testing.T) {
+	const mime = "application/x-test-registered"
+	encoding.RegisterBodyDecoder(mime, encoding.JSONBodyDecoder)
+	mimes := encoding.RegisteredBodyDecoders()
+	if !slices.IsSorted(mimes) || !slices.Contains(mimes, mime) || !slices.Contains(mimes, encoding.MIME_JSON) {
+		t.Fatal(mimes)
+	}
+}
+
+func TestDecodeTypedMap(t *testing.T) {
+	var values = map[string][]string{
+		"flag.a": {"1"},
+		"flag.b": {"0", "2"},
+	}
+	var flags map[string]int
+	if err := encoding.FormDecoder.DecodeMap(values, &flags); err != nil || !reflect.DeepEqual(flags, map[string]int{"flag.a": 1, "flag.b": 0}) {
+		t.Fatal(flags, err)
+	}
+	var all map[string][]int
+	if err := encoding.FormDecoder.DecodeMap(values, &all); err != nil || !reflect.DeepEqual(all, map[string][]int{"flag.a": {1}, "flag.b": {0, 2}}) {
+		t.Fatal(all, err)
+	}
+
+	values["bad1"] = []string{"x"}
+	values["bad2"] = []string{"y"}
+	var fieldErr *encoding.DecodeFieldError
+	if err := encoding.FormDecoder.DecodeMap(values, &flags); !errors.As(err, &fieldErr) || fieldErr.Name != "bad1" {
+		t.Fatal(err)
+	}
+	err := encoding.NewMapDecoder(&encoding.MapDecoderOptions{CollectErrors: true}).DecodeMap(values, &flags)
+	if err == nil || !strings.Contains(err.Error(), "bad1") || !strings.Contains(err.Error(), "bad2") {
+		t.Fatal(err)
+	}
+}
+
+func TestBase64Tag(t *testing.T) {
+	type S struct {
+		Data  []byte  `map:"data,base64"`
+		PData *[]byte `map:"pdata,base64"`
+		URL   []byte  `map:"url,base64"`
+	}
+	var s S
+	err := encoding.FormDecoder.DecodeMap(map[string][]string{
+		"data":  {"aGVsbG8="},
+		"pdata": {"aGk"},
+		"url":   {"-_8"},
+	}, &s)
+	if err != nil || string(s.Data) != "hello" || string(*s.PData) != "hi" || !reflect.DeepEqual(s.URL, []byte{0xfb, 0xff}) {
+		t.Fatal(s, err)
+	}
+	var fieldErr *encoding.DecodeFieldError
+	if err = encoding.FormDecoder.DecodeMap(map[string][]string{"data": {"!!"}}, &s); !errors.As(err, &fieldErr) || fieldErr.Name != "Data" {
+		t.Fatal(err)
+	}
+}
+
+func TestBytesField(t *testing.T) {
+	type S struct {
+		Raw   []byte
+		PRaw  *[]byte
+		Multi [][]byte
+	}
+	var s S
+	err := encoding.FormDecoder.DecodeMap(map[string][]string{
+		"Raw":   {"123", "456"},
+		"PRaw":  {"abc"},
+		"Multi": {"x", "yz"},
+	}, &s)
+	if err != nil || string(s.Raw) != "123" || string(*s.PRaw) != "abc" || !reflect.DeepEqual(s.Multi, [][]byte{[]byte("x"), []byte("yz")}) {
+		t.Fatal(s, err)
+	}
+}
+
+type postDecodeUser struct {
+	Email string
+}
+
+func (u *postDecodeUser) PostDecode() error {
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	if u.Email == "" {
+		return errors.New("empty email")
+	}
+	return nil
+}
+
+func TestPostDecoder(t *testing.T) {
+	var user postDecodeUser
+	r := gg.Must(http.NewRequest(http.MethodPost, "/?Email=+A@B.com+", strings.NewReader(`{"Email":" X@Y.com "}`)))
+	r.Header.Set("Content-Type", encoding.MIME_JSON)
+	if err := encoding.DecodeBody(r, encoding.JSONBodyDecoder, &user); err != nil || user.Email != "x@y.com" {
+		t.Fatal(user, err)
+	}
+	if err := encoding.DecodeQuery(r, nil, &user); err != nil || user.Email != "a@b.com" {
+		t.Fatal(user, err)
+	}
+	r.URL.RawQuery = "Email="
+	if err := encoding.DecodeQuery(r, nil, &user); err == nil || err.Error() != "empty email" {
+		t.Fatal(err)
+	}
+}
+
+func TestFormBodyDecoder(t *testing.T) {
+	var v struct {
+		Name string
+		IDs  []int `map:"id"`
+	}
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader("Name=a+b&id=1&id=2")))
+	r.Header.Set("Content-Type", encoding.MIME_FORM)
+	if err := encoding.DecodeBody(r, nil, &v); err != nil || v.Name != "a b" || !slices.Equal(v.IDs, []int{1, 2}) {
+		t.Fatal(v, err)
+	}
+
+	defer func(max int64) { encoding.FormMaxBodySize = max }(encoding.FormMaxBodySize)
+	encoding.FormMaxBodySize = 10
+	if err := encoding.FormBodyDecoder.DecodeBody(strings.NewReader("Name=01234"), &v); err != nil || v.Name != "01234" {
+		t.Fatal(v, err)
+	}
+	if err := encoding.FormBodyDecoder.DecodeBody(strings.NewReader("Name=012345"), &v); err != encoding.ErrFormBodyTooLarge {
+		t.Fatal(err)
+	}
+}
+
+func TestMultipartBodyDecoder(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("Name", "a")
+	mw.WriteField("id", "1")
+	mw.WriteField("id", "2")
+	fw := gg.Must(mw.CreateFormFile("file", "f.txt"))
+	fw.Write([]byte("content"))
+	mw.Close()
+
+	var v struct {
+		Name string
+		IDs  []int  `map:"id"`
+		File string `map:"file"`
+	}
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", &body))
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	if err := encoding.DecodeBody(r, nil, &v); err != nil || v.Name != "a" || !slices.Equal(v.IDs, []int{1, 2}) || v.File != "" {
+		t.Fatal(v, err)
+	}
+
+	r = gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader("")))
+	r.Header.Set("Content-Type", encoding.MIME_MULTIPART)
+	if err := encoding.DecodeBody(r, nil, &v); err != http.ErrMissingBoundary {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// interfaceFactory creates the concrete values of an interface type, see [RegisterInterface].
+type interfaceFactory struct {
+	field string                                 // Name of the discriminator field.
+	new   func(discriminator string) (any, bool) // Returns a new value for discriminator.
+}
+
+// interfaceFactories are the registered interface factories keyed by interface type.
+var interfaceFactories = make(map[reflect.Type]interfaceFactory)
+
+// RegisterInterface registers the factories of the concrete types of interface type T,
+// so [JSONBodyDecoder] can decode JSON objects into struct fields of type T, which fails otherwise.
+// The string value of field in the JSON object of such a struct field selects a factory in registry,
+// which returns a pointer to a new value of the concrete type, and the object is then decoded into it.
+// For example:
+//
+//	type Message struct {
+//		ID      string
+//		Payload Payload // An interface type.
+//	}
+//
+//	encoding.RegisterInterface("kind", map[string]func() Payload{
+//		"text":  func() Payload { return &TextPayload{} },
+//		"image": func() Payload { return &ImagePayload{} },
+//	})
+//
+// The fields of T in structs, including those nested in struct and pointer fields, are decoded this way,
+// but not the elements of slices, arrays or maps. Absent and null fields are left unchanged.
+// If the discriminator field is absent, [ErrNoDiscriminator] is returned; if there is no factory for the value,
+// [UnknownDiscriminatorError] is returned. RegisterInterface panics if T is not an interface type.
+//
+// It's not safe to call RegisterInterface concurrently with [DecodeBody].
+func RegisterInterface[T any](field string, registry map[string]func() T) {
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Interface {
+		panic(fmt.Errorf("gear: %v is not an interface type", typ))
+	}
+	interfaceFactories[typ] = interfaceFactory{field, func(discriminator string) (any, bool) {
+		factory, ok := registry[discriminator]
+		if !ok {
+			return nil, false
+		}
+		return factory(), true
+	}}
+}
+
+// UnregisterInterface removes the factories of interface type T registered by [RegisterInterface], if any.
+// It is useful to restore the state in tests.
+//
+// It's not safe to call UnregisterInterface concurrently with [DecodeBody].
+func UnregisterInterface[T any]() {
+	delete(interfaceFactories, reflect.TypeFor[T]())
+}
+
+// decodeJSONInterfaces decodes the first JSON value in r into v, populating the interface fields
+// of registered types first, see [RegisterInterface].
+func decodeJSONInterfaces(r io.Reader, v any) error {
+	var data json.RawMessage
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	return unmarshalJSON(data, v)
+}
+
+// unmarshalJSON is like json.Unmarshal, but the interface fields of registered types are populated first,
+// see [RegisterInterface].
+func unmarshalJSON(data []byte, v any) error {
+	if len(interfaceFactories) > 0 {
+		if err := populateInterfaces(data, reflect.ValueOf(v)); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// isJSONNull returns whether data is JSON null.
+func isJSONNull(data []byte) bool {
+	return bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
+
+// jsonFieldName returns the JSON object key of struct field f, or "-" if it is ignored.
+func jsonFieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// populateInterfaces sets the interface fields of registered types in val to new values of
+// the concrete types selected by the discriminators in data, the JSON value to be decoded into val,
+// so encoding/json decodes into the concrete values held by the interfaces.
+func populateInterfaces(data []byte, val reflect.Value) error {
+	switch val.Kind() {
+	case reflect.Pointer:
+		if elem := val.Type().Elem().Kind(); elem != reflect.Struct && elem != reflect.Pointer && elem != reflect.Interface {
+			return nil
+		}
+		if val.IsNil() {
+			if !val.CanSet() || isJSONNull(data) {
+				return nil
+			}
+			val.Set(reflect.New(val.Type().Elem()))
+		}
+		return populateInterfaces(data, val.Elem())
+	case reflect.Interface:
+		factory, ok := interfaceFactories[val.Type()]
+		if !ok || !val.CanSet() || isJSONNull(data) {
+			return nil
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		var discriminator string
+		if raw, ok := fields[factory.field]; !ok || json.Unmarshal(raw, &discriminator) != nil {
+			return ErrNoDiscriminator
+		}
+		v, ok := factory.new(discriminator)
+		if !ok {
+			return UnknownDiscriminatorError(discriminator)
+		}
+		val.Set(reflect.ValueOf(v))
+		return populateInterfaces(data, reflect.ValueOf(v))
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil {
+			return nil // Not an object, let encoding/json report the error.
+		}
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			f := typ.Field(i)
+			if !f.IsExported() && !f.Anonymous {
+				continue
+			}
+			if f.Anonymous && f.Tag.Get("json") == "" { // Embedded fields are promoted.
+				if err := populateInterfaces(data, val.Field(i)); err != nil {
+					return err
+				}
+				continue
+			}
+			name := jsonFieldName(f)
+			if name == "-" {
+				continue
+			}
+			raw, ok := fields[name]
+			if !ok { // encoding/json matches keys case-insensitively.
+				for key, value := range fields {
+					if strings.EqualFold(key, name) {
+						raw, ok = value, true
+						break
+					}
+				}
+			}
+			if !ok {
+				continue
+			}
+			if err := populateInterfaces(raw, val.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
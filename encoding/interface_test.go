@@ -0,0 +1,71 @@
+package encoding_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mkch/gear/encoding"
+)
+
+type payload interface {
+	Kind() string
+}
+
+type textPayload struct {
+	Text string
+}
+
+func (p *textPayload) Kind() string { return "text" }
+
+type imagePayload struct {
+	URL string
+}
+
+func (p *imagePayload) Kind() string { return "image" }
+
+type message struct {
+	ID      string
+	Payload payload `json:"payload"`
+	Reply   *struct {
+		Payload payload
+	}
+}
+
+func TestRegisterInterface(t *testing.T) {
+	encoding.RegisterInterface("kind", map[string]func() payload{
+		"text":  func() payload { return &textPayload{} },
+		"image": func() payload { return &imagePayload{} },
+	})
+	t.Cleanup(encoding.UnregisterInterface[payload])
+
+	var m message
+	err := encoding.JSONBodyDecoder.DecodeBody(strings.NewReader(
+		`{"ID":"1","payload":{"kind":"text","Text":"hi"},"reply":{"payload":{"kind":"image","URL":"u"}}}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, ok := m.Payload.(*textPayload); !ok || text.Text != "hi" || m.ID != "1" {
+		t.Fatal(m)
+	}
+	if image, ok := m.Reply.Payload.(*imagePayload); !ok || image.URL != "u" {
+		t.Fatal(m.Reply)
+	}
+
+	m = message{}
+	if err := encoding.JSONBodyDecoder.DecodeBody(strings.NewReader(`{"ID":"2","payload":null}`), &m); err != nil || m.Payload != nil || m.Reply != nil {
+		t.Fatal(m, err)
+	}
+	if err := encoding.JSONBodyDecoder.DecodeBody(strings.NewReader(`{"payload":{"kind":"video"}}`), &m); err != encoding.UnknownDiscriminatorError("video") {
+		t.Fatal(err)
+	}
+	if err := encoding.JSONBodyDecoder.DecodeBody(strings.NewReader(`{"payload":{}}`), &m); !errors.Is(err, encoding.ErrNoDiscriminator) {
+		t.Fatal(err)
+	}
+
+	encoding.UnregisterInterface[payload]()
+	m = message{}
+	if err := encoding.JSONBodyDecoder.DecodeBody(strings.NewReader(`{"payload":{"kind":"text"}}`), &m); err == nil {
+		t.Fatal(m)
+	}
+}
@@ -0,0 +1,117 @@
+package encoding
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrJSONTooDeep is returned by the decoder created by [NewJSONBodyDecoder]
+// if the nesting depth of the JSON document exceeds the limit.
+var ErrJSONTooDeep = errors.New("gear: JSON nesting too deep")
+
+// ErrJSONTooManyTokens is returned by the decoder created by [NewJSONBodyDecoder]
+// if the number of tokens of the JSON document exceeds the limit.
+var ErrJSONTooManyTokens = errors.New("gear: too many JSON tokens")
+
+// JSONDecoderOptions are options for [NewJSONBodyDecoder].
+// A zero JSONDecoderOptions consists entirely of zero values.
+type JSONDecoderOptions struct {
+	// MaxDepth is the maximum nesting depth of arrays and objects.
+	// Zero value means no limit.
+	MaxDepth int
+	// MaxTokens is the maximum number of tokens, see [json.Decoder.Token].
+	// Zero value means no limit.
+	MaxTokens int
+}
+
+// NewJSONBodyDecoder returns a [BodyDecoder] decoding body as JSON object like [JSONBodyDecoder],
+// but the JSON document is scanned while it is read, and the decoding is aborted with [ErrJSONTooDeep]
+// or [ErrJSONTooManyTokens] as soon as it exceeds the limits of opt, before the rest is read. It protects
+// the ingestion endpoints from maliciously nested payloads, which the body size limit alone can't. For example:
+//
+//	encoding.RegisterBodyDecoder(encoding.MIME_JSON,
+//		encoding.NewJSONBodyDecoder(&encoding.JSONDecoderOptions{MaxDepth: 32, MaxTokens: 10000}))
+//
+// If opt is nil, the default options are used.
+func NewJSONBodyDecoder(opt *JSONDecoderOptions) BodyDecoder {
+	var maxDepth, maxTokens int
+	if opt != nil {
+		maxDepth = opt.MaxDepth
+		maxTokens = opt.MaxTokens
+	}
+	return BodyDecoderFunc(func(body io.Reader, v any) error {
+		if maxDepth > 0 || maxTokens > 0 {
+			body = &jsonLimitReader{r: body, maxDepth: maxDepth, maxTokens: maxTokens}
+		}
+		return JSONBodyDecoder.DecodeBody(body, v)
+	})
+}
+
+// jsonLimitReader is an io.Reader which scans the JSON document read through it, and fails with
+// [ErrJSONTooDeep] if its nesting depth exceeds maxDepth, or [ErrJSONTooManyTokens] if its number of tokens,
+// counted like [encoding/json.Decoder.Token], exceeds maxTokens. Zero limit means no limit.
+type jsonLimitReader struct {
+	r         io.Reader
+	maxDepth  int
+	maxTokens int
+
+	depth    int
+	tokens   int
+	inString bool // Whether in a string.
+	escaped  bool // Whether the previous byte is a backslash in a string.
+	inScalar bool // Whether in a number or literal.
+	err      error
+}
+
+// Read implements [io.Reader].
+func (r *jsonLimitReader) Read(p []byte) (n int, err error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err = r.r.Read(p)
+	for i := 0; i < n; i++ {
+		if r.err = r.scan(p[i]); r.err != nil {
+			return i, r.err
+		}
+	}
+	return
+}
+
+// scan scans the next byte c of the document.
+func (r *jsonLimitReader) scan(c byte) error {
+	if r.inString {
+		switch {
+		case r.escaped:
+			r.escaped = false
+		case c == '\\':
+			r.escaped = true
+		case c == '"':
+			r.inString = false
+		}
+		return nil
+	}
+	switch c {
+	case ' ', '\t', '\r', '\n', ',', ':':
+		r.inScalar = false
+		return nil
+	case '"':
+		r.inScalar, r.inString = false, true
+	case '[', '{':
+		r.inScalar = false
+		if r.depth++; r.maxDepth > 0 && r.depth > r.maxDepth {
+			return ErrJSONTooDeep
+		}
+	case ']', '}':
+		r.inScalar = false
+		r.depth--
+	default:
+		if r.inScalar {
+			return nil
+		}
+		r.inScalar = true
+	}
+	if r.tokens++; r.maxTokens > 0 && r.tokens > r.maxTokens {
+		return ErrJSONTooManyTokens
+	}
+	return nil
+}
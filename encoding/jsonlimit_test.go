@@ -0,0 +1,42 @@
+package encoding_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mkch/gear/encoding"
+)
+
+func TestNewJSONBodyDecoder(t *testing.T) {
+	decoder := encoding.NewJSONBodyDecoder(&encoding.JSONDecoderOptions{MaxDepth: 3, MaxTokens: 10})
+	var v any
+	if err := decoder.DecodeBody(strings.NewReader(`{"a":[1,{"b":2}]}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.DecodeBody(strings.NewReader(`[[[[1]]]]`), &v); !errors.Is(err, encoding.ErrJSONTooDeep) {
+		t.Fatal(err)
+	}
+	if err := decoder.DecodeBody(strings.NewReader(`[1,2,3,4,5,6,7,8,9,10]`), &v); !errors.Is(err, encoding.ErrJSONTooManyTokens) {
+		t.Fatal(err)
+	}
+	deep := strings.Repeat("[", 100000) + strings.Repeat("]", 100000)
+	if err := encoding.NewJSONBodyDecoder(&encoding.JSONDecoderOptions{MaxDepth: 64}).DecodeBody(strings.NewReader(deep), &v); !errors.Is(err, encoding.ErrJSONTooDeep) {
+		t.Fatal(err)
+	}
+	// Aborted before the rest of the body is read.
+	errTooFar := errors.New("read too far")
+	body := io.MultiReader(strings.NewReader(strings.Repeat("[", 100)), iotest.ErrReader(errTooFar))
+	if err := encoding.NewJSONBodyDecoder(&encoding.JSONDecoderOptions{MaxDepth: 64}).DecodeBody(body, &v); !errors.Is(err, encoding.ErrJSONTooDeep) {
+		t.Fatal(err)
+	}
+	// Brackets in strings are not counted.
+	if err := encoding.NewJSONBodyDecoder(&encoding.JSONDecoderOptions{MaxDepth: 1, MaxTokens: 5}).DecodeBody(strings.NewReader(`{"a[[":"\\\"{{{{"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoding.NewJSONBodyDecoder(nil).DecodeBody(strings.NewReader(`{"a":1}`), &v); err != nil {
+		t.Fatal(err)
+	}
+}
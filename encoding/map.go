@@ -1,11 +1,15 @@
 package encoding
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"maps"
 	"net/http"
 	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/mkch/gg"
@@ -22,21 +26,29 @@ import (
 //   - *map[string][]string : *v is a copy of values.
 //   - *map[string]string   : *v has the same content of values but each pair only has the firs value.
 //   - *map[string]any      : *v has the same content as above but with any value type.
+//   - *map[string]T        : each value is converted to T the same way as a struct field of type T,
+//     where T is one of the field types below. For example *map[string]int or *map[string][]int.
 //
 // or any *struct type. The struct field can be one of the following types.
 //   - string
 //   - integers(int8, int18, uint, uintptr etc).
 //   - floats(float32, float64).
+//   - []byte : the raw bytes of the value, see also the base64 tag option below.
 //   - Pointers or slices of the the above.
 //   - Type implements [MapValueUnmarshaler].
 //
-// A Value is converted to the type of the field, if conversion failed, an [DecodeFieldError] will be returned.
+// A Value is converted to the type of the field, if conversion failed, an [DecodeFieldError] will be returned
+// (or all of them joined, see [MapDecoderOptions].CollectErrors).
 // Slices and pointers are allocated as necessary. A Slice field contains all the values of the key,
 // non-slice field contains the first value only. A FormValueUnmarshaler decodes []string into itself.
 //
 // The follow field tags can be used:
 //   - `map:"key_name"` : key_name is the name of the key.
 //   - `map:"-"`        : this field is ignored.
+//   - `map:"key_name,base64"` : the value is base64 decoded(standard or URL encoding, padded or not)
+//     into a []byte field(or a pointer to it). An invalid value results in a [DecodeFieldError].
+//   - `delim:","`      : each value is split by "," before being decoded into a slice field(or a pointer to it),
+//     so "?ids=1,2,3" can be decoded into []int{1, 2, 3}. It has no effect on non-slice fields.
 type MapDecoder interface {
 	DecodeMap(values map[string][]string, v any) error
 }
@@ -44,8 +56,14 @@ type MapDecoder interface {
 // Field tag used by [MapDecoder].
 const mapDecoderTag = "map"
 
+// Field tag of the delimiter used by [MapDecoder] to split values.
+const mapDecoderDelimTag = "delim"
+
 // MapValueUnmarshaler is the interface implemented by types that can unmarshal form []string.
 // [MapDecoder] decodes a MapValueUnmarshaler value by calling it's UnmarshalMapValue() method.
+// A field implementing MapValueUnmarshaler, even if it is a slice, receives all the values of the key at once,
+// while each element of a slice field whose element type, T or *T, implements MapValueUnmarshaler
+// receives a single value, so "name=a+b&name=c+d" is decoded into a []*T field of two elements.
 // UnmarshalMapValue must copy the slice if it wishes to retain the data after returning.
 type MapValueUnmarshaler interface {
 	// UnmarshalMapValue unmarshal from value.
@@ -114,6 +132,9 @@ func (e *DecodeFieldError) Error() string {
 
 // DecodeForm decodes r.Form using decoder and stores the result in the value pointed by v.
 // If decoder is nil, [FormDecoder] will be used.
+// r.Form contains both the URL query and the body values, with the body values listed first,
+// so a body value takes precedence over a query value of the same key for non-slice fields,
+// and slice fields receive both. Use [DecodePostForm] to decode the body values only.
 // Note: r.ParseForm or ParseMultipartForm should be call to populate r.Form.
 func DecodeForm(r *http.Request, decoder MapDecoder, v any) (err error) {
 	if decoder == nil {
@@ -122,6 +143,17 @@ func DecodeForm(r *http.Request, decoder MapDecoder, v any) (err error) {
 	return validateMap(decoder.DecodeMap, r.Form, v)
 }
 
+// DecodePostForm decodes r.PostForm, the body values without the URL query, using decoder
+// and stores the result in the value pointed by v.
+// If decoder is nil, [FormDecoder] will be used.
+// Note: r.ParseForm or ParseMultipartForm should be call to populate r.PostForm.
+func DecodePostForm(r *http.Request, decoder MapDecoder, v any) (err error) {
+	if decoder == nil {
+		decoder = FormDecoder
+	}
+	return validateMap(decoder.DecodeMap, r.PostForm, v)
+}
+
 // DecodeForm decodes r.Header using decoder and stores the result in the value pointed by v.
 // If decoder is nil, [HeaderDecoder] will be used.
 func DecodeHeader(r *http.Request, decoder MapDecoder, v any) (err error) {
@@ -163,12 +195,58 @@ func (date *HTTPDate) UnmarshalMapValue(value []string) error {
 	}
 }
 
-var defaultMapDecoder = MapDecoderFunc(decodeMap)
+// MapDecoderOptions are options for [NewMapDecoder]. A zero MapDecoderOptions consists entirely of zero values.
+type MapDecoderOptions struct {
+	// CollectErrors makes DecodeMap continue past field errors.
+	// If CollectErrors is true, DecodeMap returns a joined error(see [errors.Join])
+	// of every [DecodeFieldError] occurred.
+	// Zero value means decoding stops at the first bad field.
+	CollectErrors bool
+	// IndexedKeys enables decoding indexed keys into slice fields.
+	// If IndexedKeys is true, keys "key[N]" are decoded into the elements of slice field "key" in order of N,
+	// and keys "key[N].field" are grouped by N and decoded into the struct elements. Sparse indices are compacted.
+	// The indexed keys, if any, take precedence over the plain key "key".
+	// Zero value means indexed keys are not recognized.
+	IndexedKeys bool
+	// EmptyAsNil makes empty values leave pointer and slice fields unchanged.
+	// If EmptyAsNil is true, a key whose values are all empty, such as "age=", is not assigned
+	// to pointer and slice fields, so a nil *int field stays nil instead of pointing to 0,
+	// which distinguishes "unset" from "zero".
+	// Zero value means empty values are assigned as is.
+	EmptyAsNil bool
+	// LastValue makes non-slice fields take the last value of a repeated key, instead of the first one,
+	// for clients sending defaults first and overrides last. Slice fields and fields implementing
+	// [MapValueUnmarshaler] still receive all the values.
+	// Zero value means the first value wins.
+	LastValue bool
+}
+
+// mapDecoder is the default implementation of [MapDecoder].
+type mapDecoder struct {
+	opt MapDecoderOptions
+}
+
+// DecodeMap implements [MapDecoder].
+func (d *mapDecoder) DecodeMap(values map[string][]string, v any) error {
+	return decodeMap(values, v, &d.opt)
+}
+
+// NewMapDecoder returns the default [MapDecoder] implementation configured with opt.
+// If opt is nil, the default options are used.
+func NewMapDecoder(opt *MapDecoderOptions) MapDecoder {
+	var d = &mapDecoder{}
+	if opt != nil {
+		d.opt = *opt
+	}
+	return d
+}
+
+var defaultMapDecoder = NewMapDecoder(nil)
 
 // FormDecoder is the default [MapDecoder] implementation to decode HTTP forms.
 var FormDecoder MapDecoder = defaultMapDecoder
 
-// DefaultFormDecoder is the default [MapDecoder] implementation to decode HTTP headers.
+// HeaderDecoder is the default [MapDecoder] implementation to decode HTTP headers.
 var HeaderDecoder MapDecoder = defaultMapDecoder
 
 // QueryDecoder is the default [MapDecoder] implementation to decode URL queries.
@@ -184,7 +262,7 @@ func mapGet(m map[string][]string, key string) string {
 }
 
 // decodeMap is the default implementation of [MapDecoder.DecodeMap].
-func decodeMap(values map[string][]string, v any) error {
+func decodeMap(values map[string][]string, v any, opt *MapDecoderOptions) error {
 	typ := reflect.TypeOf(v)
 	val := reflect.ValueOf(v)
 	if typ == nil || typ.Kind() != reflect.Pointer || !val.IsValid() {
@@ -225,12 +303,28 @@ func decodeMap(values map[string][]string, v any) error {
 		return nil
 	}
 
-	// Cannot decode into types other than struct.
-	if typ.Kind() != reflect.Struct {
+	var errs []error
+	switch {
+	case typ.Kind() == reflect.Map && typ.Key().Kind() == reflect.String:
+		errs = decodeTypedMap(values, val, opt)
+	case typ.Kind() == reflect.Struct:
+		errs = decodeStruct(values, val, opt, "")
+	default:
+		// Cannot decode into types other than struct and map.
 		return &DecodeTypeError{typ}
 	}
+	if len(errs) == 0 {
+		return nil
+	} else if !opt.CollectErrors {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
 
-	// Processing struct fields.
+// decodeStruct decodes values into struct val. It returns the field errors occurred, or only the first
+// one if opt.CollectErrors is false. The Name of the errors are prefixed with namePrefix.
+func decodeStruct(values map[string][]string, val reflect.Value, opt *MapDecoderOptions, namePrefix string) (errs []error) {
+	typ := val.Type()
 	for i, nField := 0, typ.NumField(); i < nField; i++ {
 		field := typ.Field(i)
 		if !field.IsExported() || field.Anonymous {
@@ -245,19 +339,283 @@ func decodeMap(values map[string][]string, v any) error {
 		if tag == "-" {
 			continue // ignore
 		}
+		tag, tagOpts, _ := strings.Cut(tag, ",")
 		// key to map
 		var key string = gg.If(tag != "", tag, field.Name)
+		var name = namePrefix + field.Name
+		if opt.IndexedKeys && field.Type.Kind() == reflect.Slice {
+			if indexed := indexedValues(values, key); indexed != nil {
+				errs = append(errs, decodeIndexed(indexed, val.Field(i), opt, name)...)
+				if len(errs) > 0 && !opt.CollectErrors {
+					return
+				}
+				continue
+			}
+		}
 		if _, ok := values[key]; !ok {
 			continue // key not found
 		}
-		if err := parseMapValue(values[key], val.Field(i)); err != nil {
-			err.Name = field.Name
-			return err
+		var fieldValues = values[key]
+		if opt.EmptyAsNil && isNilableKind(field.Type.Kind()) && allEmpty(fieldValues) {
+			continue
+		}
+		if delim := field.Tag.Get(mapDecoderDelimTag); delim != "" && isSliceType(field.Type) {
+			fieldValues = splitValues(fieldValues, delim)
+		}
+		if opt.LastValue {
+			fieldValues = lastValue(fieldValues, field.Type)
+		}
+		var parse = parseMapValue
+		if hasTagOption(tagOpts, "base64") && isBytesType(field.Type) {
+			parse = parseBase64Value
+		}
+		if err := parse(fieldValues, val.Field(i)); err != nil {
+			err.Name = name
+			errs = append(errs, err)
+			if !opt.CollectErrors {
+				return
+			}
 		}
 	}
+	return
+}
+
+// decodeTypedMap decodes values into map val, whose key type is string, converting each value
+// to the element type of val. It returns the errors occurred, or only the first one if
+// opt.CollectErrors is false. The Name of the errors are the keys.
+func decodeTypedMap(values map[string][]string, val reflect.Value, opt *MapDecoderOptions) (errs []error) {
+	typ := val.Type()
+	if val.IsNil() {
+		val.Set(reflect.MakeMapWithSize(typ, len(values)))
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys) // Stable error order.
+	for _, key := range keys {
+		if opt.EmptyAsNil && isNilableKind(typ.Elem().Kind()) && allEmpty(values[key]) {
+			continue
+		}
+		elem := reflect.New(typ.Elem()).Elem()
+		var elemValues = values[key]
+		if opt.LastValue {
+			elemValues = lastValue(elemValues, typ.Elem())
+		}
+		if err := parseMapValue(elemValues, elem); err != nil {
+			err.Name = key
+			errs = append(errs, err)
+			if !opt.CollectErrors {
+				return
+			}
+			continue
+		}
+		val.SetMapIndex(reflect.ValueOf(key).Convert(typ.Key()), elem)
+	}
+	return
+}
+
+// isNilableKind returns whether kind is reflect.Pointer or reflect.Slice, which are left nil by
+// [MapDecoderOptions.EmptyAsNil].
+func isNilableKind(kind reflect.Kind) bool {
+	return kind == reflect.Pointer || kind == reflect.Slice
+}
+
+// allEmpty returns whether every value in values is empty.
+func allEmpty(values []string) bool {
+	for _, value := range values {
+		if value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// lastValue returns the last value in values as a slice, if values are decoded into a single value of type t,
+// see [MapDecoderOptions.LastValue]. Otherwise values is returned as is.
+func lastValue(values []string, t reflect.Type) []string {
+	if len(values) <= 1 || t.Implements(formUnmarshalerType) || reflect.PointerTo(t).Implements(formUnmarshalerType) {
+		return values
+	}
+	if isSliceType(t) && !isBytesType(t) {
+		return values
+	}
+	return values[len(values)-1:]
+}
+
+// hasTagOption returns whether the comma-separated tag options opts contains opt.
+func hasTagOption(opts string, opt string) bool {
+	for opts != "" {
+		var o string
+		o, opts, _ = strings.Cut(opts, ",")
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// isBytesType returns whether t is []byte or a pointer to it.
+func isBytesType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t == bytesType
+}
+
+// base64Encodings are the encodings tried in order by parseBase64Value.
+var base64Encodings = []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding}
+
+// parseBase64Value base64 decodes the first value in values into dest, which is a []byte or a pointer to it.
+// If err is not nil, the Name field is not set.
+func parseBase64Value(values []string, dest reflect.Value) *DecodeFieldError {
+	var value string
+	if len(values) > 0 {
+		value = values[0]
+	}
+	var data []byte
+	var err error
+	for _, enc := range base64Encodings {
+		if data, err = enc.DecodeString(value); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return &DecodeFieldError{Type: dest.Type(), Value: value, Err: err}
+	}
+	if dest.Kind() == reflect.Pointer {
+		p := reflect.New(bytesType)
+		p.Elem().SetBytes(data)
+		dest.Set(p)
+	} else {
+		dest.SetBytes(data)
+	}
 	return nil
 }
 
+// isSliceType returns whether t is a slice type or a pointer to it.
+func isSliceType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice
+}
+
+// splitValues splits each value in values by delim and returns all the parts.
+func splitValues(values []string, delim string) []string {
+	var ret = make([]string, 0, len(values))
+	for _, value := range values {
+		ret = append(ret, strings.Split(value, delim)...)
+	}
+	return ret
+}
+
+// indexedValues collects the values of indexed keys "key[N]" and "key[N].sub" in values.
+// The returned map is keyed by N, and the values are maps of "sub"("" for "key[N]") to values.
+// Nil is returned if there is no indexed key.
+func indexedValues(values map[string][]string, key string) (indexed map[int]map[string][]string) {
+	var prefix = key + "["
+	for k, v := range values {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			continue
+		}
+		n, err := strconv.Atoi(rest[:end])
+		if err != nil || n < 0 {
+			continue
+		}
+		sub := rest[end+1:]
+		if sub != "" {
+			if sub, ok = strings.CutPrefix(sub, "."); !ok || sub == "" {
+				continue
+			}
+		}
+		if indexed == nil {
+			indexed = make(map[int]map[string][]string)
+		}
+		if indexed[n] == nil {
+			indexed[n] = make(map[string][]string)
+		}
+		indexed[n][sub] = v
+	}
+	return
+}
+
+// decodeIndexed decodes indexed values(see indexedValues) into slice dest, sorted by index.
+// Struct elements are decoded from "key[N].field" values, other elements from "key[N]" values.
+// The Name of the returned errors are prefixed with name[N].
+func decodeIndexed(indexed map[int]map[string][]string, dest reflect.Value, opt *MapDecoderOptions, name string) (errs []error) {
+	elemType := dest.Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Pointer {
+		structType = structType.Elem()
+	}
+	isStruct := structType.Kind() == reflect.Struct &&
+		!elemType.Implements(formUnmarshalerType) && !reflect.PointerTo(elemType).Implements(formUnmarshalerType)
+	indices := make([]int, 0, len(indexed))
+	for n := range indexed {
+		indices = append(indices, n)
+	}
+	slices.Sort(indices)
+	s := dest
+	for _, n := range indices {
+		var elem = reflect.New(elemType).Elem()
+		var elemName = fmt.Sprintf("%v[%v]", name, n)
+		if isStruct {
+			target := elem
+			if elemType.Kind() == reflect.Pointer {
+				elem.Set(reflect.New(structType))
+				target = elem.Elem()
+			}
+			errs = append(errs, decodeStruct(indexed[n], target, opt, elemName+".")...)
+		} else if values, ok := indexed[n][""]; ok {
+			if err := parseMapValue(values, elem); err != nil {
+				err.Name = elemName
+				errs = append(errs, err)
+			}
+		} else {
+			continue
+		}
+		if len(errs) > 0 && !opt.CollectErrors {
+			return
+		}
+		s = reflect.Append(s, elem)
+	}
+	dest.Set(s)
+	return
+}
+
+// DecodeValues converts values to the type of the value pointed by v and stores the result in it.
+// The conversion is the same as the one used by [MapDecoder] to decode struct fields,
+// see [MapDecoder] for the supported types.
+// If v is nil or not a pointer, DecodeValues returns an [InvalidDecodeError].
+// If the conversion failed, a [DecodeFieldError] with empty Name is returned.
+func DecodeValues(values []string, v any) error {
+	val := reflect.ValueOf(v)
+	if !val.IsValid() || val.Kind() != reflect.Pointer || val.IsNil() {
+		return &InvalidDecodeError{reflect.TypeOf(v)}
+	}
+	if err := parseMapValue(values, val.Elem()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// unmarshalerValue returns the Value of the [DecodeFieldError] of a [MapValueUnmarshaler] failing to unmarshal values:
+// the value itself if there is only one, the case of slice elements, like other types, or the formatted values otherwise.
+func unmarshalerValue(values []string) string {
+	if len(values) == 1 {
+		return values[0]
+	}
+	return fmt.Sprintf("%v", values)
+}
+
 var formUnmarshalerType = reflect.TypeOf((*MapValueUnmarshaler)(nil)).Elem()
 
 // parseMapValue parses values into dest. Return non-nil if error occurs.
@@ -273,14 +631,14 @@ func parseMapValue(values []string, dest reflect.Value) *DecodeFieldError {
 		unmarshaler := dest.Interface().(MapValueUnmarshaler)
 		err = unmarshaler.UnmarshalMapValue(values)
 		if err != nil {
-			return &DecodeFieldError{Type: t, Value: fmt.Sprintf("%v", values), Err: err}
+			return &DecodeFieldError{Type: t, Value: unmarshalerValue(values), Err: err}
 		}
 		return nil
 	} else if pt := reflect.PointerTo(t); pt.Implements(formUnmarshalerType) {
 		// *t implements MapValueUnmarshaler
 		err = dest.Addr().Interface().(MapValueUnmarshaler).UnmarshalMapValue(values)
 		if err != nil {
-			return &DecodeFieldError{Type: t, Value: fmt.Sprintf("%v", values), Err: err}
+			return &DecodeFieldError{Type: t, Value: unmarshalerValue(values), Err: err}
 		}
 		return nil
 	}
@@ -289,6 +647,11 @@ func parseMapValue(values []string, dest reflect.Value) *DecodeFieldError {
 	if len(values) > 0 {
 		value = values[0]
 	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		// Special case: []byte receives the raw bytes, not elements converted one by one.
+		dest.SetBytes([]byte(value))
+		return nil
+	}
 	switch t.Kind() {
 	case reflect.Pointer:
 		var p = reflect.New(t.Elem())                           // alloc
@@ -0,0 +1,76 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// NDJSONMaxLineSize is the maximum number of bytes of a line read by [NDJSONBodyDecoder] and [DecodeNDJSON],
+// excluding the line ending. Longer lines fail the decoding with [ErrNDJSONLineTooLong].
+var NDJSONMaxLineSize = 1 << 20
+
+// ErrNDJSONLineTooLong is returned, wrapped with the line number, if a line of NDJSON is longer than [NDJSONMaxLineSize].
+var ErrNDJSONLineTooLong = errors.New("gear: NDJSON line too long")
+
+// NDJSONBodyDecoder decodes body as newline-delimited JSON, one JSON value per line, into a pointer to slice,
+// appending a decoded element for each line. Blank lines are skipped.
+// The body is read line by line, so it is never buffered as a whole, but the decoded slice is.
+// Use [DecodeNDJSON] to process the records one by one without building the slice.
+var NDJSONBodyDecoder BodyDecoder = BodyDecoderFunc(func(body io.Reader, v any) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Pointer || val.IsNil() || val.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("gear: NDJSON can't be decoded into %T", v)
+	}
+	s := val.Elem()
+	return readNDJSON(body, func(line []byte) error {
+		elem := reflect.New(s.Type().Elem())
+		if err := unmarshalJSON(line, elem.Interface()); err != nil {
+			return err
+		}
+		s.Set(reflect.Append(s, elem.Elem()))
+		return nil
+	})
+})
+
+// DecodeNDJSON decodes body as newline-delimited JSON, and calls f with each record decoded into a T,
+// in order, so large imports are processed without buffering them in memory. Blank lines are skipped.
+// Each record is post-processed and validated like [DecodeBody] does before f is called.
+// DecodeNDJSON stops at the first error, either returned by f or occurred decoding a line,
+// and returns it wrapped with the line number.
+func DecodeNDJSON[T any](body io.Reader, f func(v T) error) error {
+	return readNDJSON(body, func(line []byte) error {
+		var v T
+		if err := validate(unmarshalJSON, line, &v); err != nil {
+			return err
+		}
+		return f(v)
+	})
+}
+
+// readNDJSON reads body line by line, and calls f with each non-blank line.
+// The line passed to f is only valid until f returns.
+// The errors returned by f are wrapped with the line number.
+func readNDJSON(body io.Reader, f func(line []byte) error) error {
+	s := bufio.NewScanner(body)
+	s.Buffer(nil, NDJSONMaxLineSize+2) // +2 for "\r\n".
+	var n int
+	for s.Scan() {
+		n++
+		if len(s.Bytes()) > NDJSONMaxLineSize {
+			return fmt.Errorf("gear: NDJSON line %d: %w", n, ErrNDJSONLineTooLong)
+		}
+		if line := bytes.TrimSpace(s.Bytes()); len(line) > 0 {
+			if err := f(line); err != nil {
+				return fmt.Errorf("gear: NDJSON line %d: %w", n, err)
+			}
+		}
+	}
+	if err := s.Err(); err != bufio.ErrTooLong {
+		return err
+	}
+	return fmt.Errorf("gear: NDJSON line %d: %w", n+1, ErrNDJSONLineTooLong)
+}
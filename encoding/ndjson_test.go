@@ -0,0 +1,68 @@
+package encoding_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mkch/gear/encoding"
+	"github.com/mkch/gg"
+)
+
+func TestNDJSONBodyDecoder(t *testing.T) {
+	type Item struct{ A int }
+	r := gg.Must(http.NewRequest(http.MethodPost, "/", strings.NewReader("{\"A\":1}\n\n{\"A\":2}\r\n{\"A\":3}")))
+	r.Header.Set("Content-Type", encoding.MIME_NDJSON)
+	var items []Item
+	if err := encoding.DecodeBody(r, nil, &items); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(items, []Item{{1}, {2}, {3}}) {
+		t.Fatal(items)
+	}
+
+	var item Item
+	if err := encoding.NDJSONBodyDecoder.DecodeBody(strings.NewReader(`{"A":1}`), &item); err == nil {
+		t.Fatal(item)
+	}
+	if err := encoding.NDJSONBodyDecoder.DecodeBody(strings.NewReader("{\"A\":1}\n{\"A\":"), &items); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatal(err)
+	}
+	maxLine := `"` + strings.Repeat("a", encoding.NDJSONMaxLineSize-2) + `"`
+	var strs []string
+	for _, suffix := range []string{" ", "   \n"} {
+		if err := encoding.NDJSONBodyDecoder.DecodeBody(strings.NewReader("\"a\"\n"+maxLine+suffix), &strs); !errors.Is(err, encoding.ErrNDJSONLineTooLong) || !strings.Contains(err.Error(), "line 2") {
+			t.Fatal(err)
+		}
+	}
+	if err := encoding.NDJSONBodyDecoder.DecodeBody(strings.NewReader(maxLine+"\r\n"), &strs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDecodeNDJSON(t *testing.T) {
+	type Item struct{ A int }
+	var items []Item
+	if err := encoding.DecodeNDJSON(strings.NewReader("{\"A\":1}\n{\"A\":2}\n"), func(item Item) error {
+		items = append(items, item)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(items, []Item{{1}, {2}}) {
+		t.Fatal(items)
+	}
+
+	var errStop = errors.New("stop")
+	var n int
+	if err := encoding.DecodeNDJSON(strings.NewReader("1\n2\n3\n"), func(v int) error {
+		if n++; v == 2 {
+			return errStop
+		}
+		return nil
+	}); !errors.Is(err, errStop) || n != 2 {
+		t.Fatal(err, n)
+	}
+}
@@ -0,0 +1,77 @@
+package encoding
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// ProtoMessage is the interface implemented by protocol buffer messages generated by protoc-gen-go.
+// It is used instead of proto.Message to avoid depending on the protobuf runtime.
+type ProtoMessage interface {
+	Reset()
+	String() string
+	ProtoMessage()
+}
+
+// ErrNoProtobufCodec is returned by [UnmarshalProtobuf] and [MarshalProtobuf] if no protobuf codec is provided.
+var ErrNoProtobufCodec = errors.New("gear: no protobuf codec, see encoding.UnmarshalProtobuf and encoding.MarshalProtobuf")
+
+// NotProtoMessageError is returned by [ProtobufBodyDecoder] and [EncodeProtobuf]
+// if the value is not a [ProtoMessage].
+type NotProtoMessageError struct {
+	Type reflect.Type
+}
+
+func (err *NotProtoMessageError) Error() string {
+	if err.Type == nil {
+		return "gear: nil is not a protobuf message"
+	}
+	return "gear: " + err.Type.String() + " is not a protobuf message"
+}
+
+// UnmarshalProtobuf parses the wire-format message in data and places the result in m.
+// This package does not depend on the protobuf runtime, UnmarshalProtobuf returns [ErrNoProtobufCodec]
+// until it is replaced. For example, with google.golang.org/protobuf/proto:
+//
+//	encoding.UnmarshalProtobuf = func(data []byte, m encoding.ProtoMessage) error {
+//		return proto.Unmarshal(data, m.(proto.Message))
+//	}
+var UnmarshalProtobuf = func(data []byte, m ProtoMessage) error {
+	return ErrNoProtobufCodec
+}
+
+// MarshalProtobuf returns the wire-format encoding of m.
+// Like [UnmarshalProtobuf], MarshalProtobuf returns [ErrNoProtobufCodec] until it is replaced.
+var MarshalProtobuf = func(m ProtoMessage) ([]byte, error) {
+	return nil, ErrNoProtobufCodec
+}
+
+// ProtobufBodyDecoder decodes body as a protobuf message using [UnmarshalProtobuf].
+// v must implement [ProtoMessage], or a [NotProtoMessageError] is returned.
+var ProtobufBodyDecoder BodyDecoder = BodyDecoderFunc(func(body io.Reader, v any) error {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return &NotProtoMessageError{reflect.TypeOf(v)}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return UnmarshalProtobuf(data, m)
+})
+
+// EncodeProtobuf writes the protobuf encoding of v to the stream w using [MarshalProtobuf].
+// v must implement [ProtoMessage], or a [NotProtoMessageError] is returned.
+func EncodeProtobuf(v any, w io.Writer) error {
+	m, ok := v.(ProtoMessage)
+	if !ok {
+		return &NotProtoMessageError{reflect.TypeOf(v)}
+	}
+	data, err := MarshalProtobuf(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,92 @@
+package gear
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mkch/gear/encoding"
+	"github.com/mkch/gg"
+)
+
+// EnvelopeOptions are options for [Envelope]. A zero EnvelopeOptions consists entirely of zero values.
+type EnvelopeOptions struct {
+	// OKKey is the key of the boolean field indicating success.
+	// Zero value means "ok".
+	OKKey string
+	// DataKey is the key of the field holding a successful response.
+	// Zero value means "data".
+	DataKey string
+	// ErrorKey is the key of the field holding an error response.
+	// Zero value means "error".
+	ErrorKey string
+}
+
+// isJSONContentType returns whether ct is a JSON media type.
+func isJSONContentType(ct string) bool {
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	return mediaType == encoding.MIME_JSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// Envelope returns a [Middleware] which wraps the JSON responses in an envelope.
+// The response of the handler is buffered, and if it is a non-empty JSON response,
+// which has a JSON Content-Type header, or no Content-Type header but a valid JSON body,
+// it is rewritten as {"ok":true,"data":...} if the status code is below 400,
+// or {"ok":false,"error":...} otherwise. Non-JSON responses pass through untouched.
+// WebSocket upgrades and server-sent event streams are not buffered,
+// see [Gear.IsWebSocket] and [Gear.IsEventStream].
+// If opt is nil, the default options are used.
+func Envelope(opt *EnvelopeOptions) Middleware {
+	var okKey, dataKey, errorKey = "ok", "data", "error"
+	if opt != nil {
+		okKey = gg.If(opt.OKKey != "", opt.OKKey, okKey)
+		dataKey = gg.If(opt.DataKey != "", opt.DataKey, dataKey)
+		errorKey = gg.If(opt.ErrorKey != "", opt.ErrorKey, errorKey)
+	}
+	var quotedOK = gg.Must(json.Marshal(okKey))
+	var quotedData = gg.Must(json.Marshal(dataKey))
+	var quotedError = gg.Must(json.Marshal(errorKey))
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		if g.IsWebSocket() {
+			next(g)
+			return
+		}
+		var w = g.W
+		var bw = newBufferWriter(w)
+		g.W = bw
+		defer func() { g.W = w }()
+		next(g)
+		if bw.streaming {
+			return
+		}
+
+		var body = bw.body.Bytes()
+		var ct = bw.header.Get("Content-Type")
+		if len(bytes.TrimSpace(body)) > 0 && (isJSONContentType(ct) || (ct == "" && json.Valid(body))) {
+			var ok = bw.status() < http.StatusBadRequest
+			var buf bytes.Buffer
+			buf.Grow(len(body) + len(quotedOK) + len(quotedData) + len(quotedError) + 10)
+			buf.WriteByte('{')
+			buf.Write(quotedOK)
+			buf.WriteByte(':')
+			buf.WriteString(strconv.FormatBool(ok))
+			buf.WriteByte(',')
+			buf.Write(gg.If(ok, quotedData, quotedError))
+			buf.WriteByte(':')
+			buf.Write(bytes.TrimSpace(body))
+			buf.WriteByte('}')
+			body = buf.Bytes()
+			bw.header.Del("Content-Length")
+			if ct == "" {
+				bw.header.Set("Content-Type", encoding.MIME_JSON)
+			}
+		}
+		LogIfErr(bw.replay(w, body))
+	}, "Envelope")
+}
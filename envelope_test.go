@@ -0,0 +1,58 @@
+package gear_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+func TestEnvelope(t *testing.T) {
+	var tests = []struct {
+		opt  *gear.EnvelopeOptions
+		code int
+		v    any
+		text string
+		want string
+	}{
+		{nil, http.StatusOK, map[string]int{"a": 1}, "", `{"ok":true,"data":{"a":1}}`},
+		{nil, http.StatusNotFound, "not found", "", `{"ok":false,"error":"not found"}`},
+		{&gear.EnvelopeOptions{OKKey: "success", DataKey: "result"}, http.StatusCreated, 1, "", `{"success":true,"result":1}`},
+		{nil, http.StatusOK, nil, "plain", "plain"},
+	}
+	for _, test := range tests {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+			http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+			if test.text != "" {
+				gear.G(r).StringResponse(test.code, test.text)
+			} else {
+				gear.G(r).JSONResponse(test.code, test.v)
+			}
+		}, gear.Envelope(test.opt))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != test.code || w.Body.String() != test.want {
+			t.Fatal(test, w.Code, w.Body.String())
+		}
+		if cookies := w.Result().Cookies(); len(cookies) != 2 {
+			t.Fatal(cookies)
+		}
+	}
+}
+
+func TestEnvelopeEventStream(t *testing.T) {
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		http.NewResponseController(w).Flush()
+		io.WriteString(w, "data: 2\n\n")
+	}, gear.Envelope(nil))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !w.Flushed || w.Body.String() != "data: 1\n\ndata: 2\n\n" || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatal(w.Flushed, w.Body.String(), w.Header())
+	}
+}
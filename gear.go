@@ -1,16 +1,26 @@
 package gear
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/mkch/gear/encoding"
@@ -23,9 +33,145 @@ const ctxKey contextKey = "gear"
 
 // Gear, the core of this framework.
 type Gear struct {
-	R       *http.Request       // R of this request.
-	W       http.ResponseWriter // W of this request.
-	stopped bool                // Whether g.Stop() has been called.
+	R        *http.Request       // R of this request.
+	W        http.ResponseWriter // W of this request.
+	stopped  bool                // Whether g.Stop() has been called.
+	values   map[string]any      // Request-scoped values, see Set and Get.
+	query    url.Values          // Parsed URL query of R, see Query.
+	rawQuery string              // Raw query string query is parsed from.
+	method   string              // Original method of the request if overridden, see MethodOverride.
+	logger   *slog.Logger        // Request-scoped logger, see Logger.
+	rawLog   *slog.Logger        // RawLogger the logger is derived from.
+}
+
+// Set stores v with key in g. The value lives as long as the request and survives
+// request replacement. Unlike [Gear.SetContextValue], Set does not allocate a new request,
+// but the value is not visible to g.R.Context() consumers.
+// Set is not safe for concurrent use.
+func (g *Gear) Set(key string, v any) {
+	if g.values == nil {
+		g.values = make(map[string]any)
+	}
+	g.values[key] = v
+}
+
+// Get returns the value stored with key by [Gear.Set] and whether it exists.
+func (g *Gear) Get(key string) (v any, ok bool) {
+	v, ok = g.values[key]
+	return
+}
+
+// SetRequest replaces g.R with r. It is the supported way for a middleware to rewrite
+// the request, e.g. stripping path prefix, and the downstream middlewares and handler see r.
+// If the context of r does not carry g, SetRequest adds it, so [G] still works with the new request.
+func (g *Gear) SetRequest(r *http.Request) {
+	if getGear(r) != g {
+		r = r.WithContext(context.WithValue(r.Context(), ctxKey, g))
+	}
+	g.R = r
+	g.query = nil // Invalidate the cached query.
+}
+
+// Context returns the context of the request. It is a shortcut of g.R.Context().
+func (g *Gear) Context() context.Context {
+	return g.R.Context()
+}
+
+// WithContext replaces the context of the request with ctx, which is usually derived from
+// [Gear.Context], so the downstream middlewares and handler see it. For example:
+//
+//	ctx, cancel := context.WithTimeout(g.Context(), time.Second)
+//	defer cancel()
+//	g.WithContext(ctx)
+//
+// Like [Gear.SetRequest], if ctx does not carry g, WithContext adds it.
+func (g *Gear) WithContext(ctx context.Context) {
+	g.SetRequest(g.R.WithContext(ctx))
+}
+
+// OriginalMethod returns the method of the request on the wire, which differs from g.R.Method
+// if it has been overridden by [MethodOverride].
+func (g *Gear) OriginalMethod() string {
+	if g.method != "" {
+		return g.method
+	}
+	return g.R.Method
+}
+
+// LogValue implements [slog.LogValuer]. The request is logged as a group of "method", "path", "remote"
+// and "request_id"(see [Gear.RequestID], if present), so g can be logged directly:
+//
+//	gear.RawLogger.Info("handling", "req", g)
+func (g *Gear) LogValue() slog.Value {
+	var attrs = make([]slog.Attr, 0, 4)
+	attrs = append(attrs,
+		slog.String(LoggerMethodKey, g.R.Method),
+		slog.String("path", g.R.URL.Path),
+		slog.String("remote", g.R.RemoteAddr))
+	if id := g.RequestID(); id != "" {
+		attrs = append(attrs, slog.String(LoggerRequestIDKey, id))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// Logger returns [RawLogger] with the request-scoped attributes "request_id"(see [Gear.RequestID], if present),
+// "method" and "path", so the logs of handlers are correlated with the request:
+//
+//	g.Logger().Info("processed order", "id", orderID)
+//
+// The logger is cached in g, and created again only if RawLogger is replaced.
+// The attributes are those when the logger is created, so call Logger after [RequestID] has served.
+func (g *Gear) Logger() *slog.Logger {
+	if g.logger == nil || g.rawLog != RawLogger {
+		var args = make([]any, 0, 3)
+		if id := g.RequestID(); id != "" {
+			args = append(args, slog.String(LoggerRequestIDKey, id))
+		}
+		args = append(args, slog.String(LoggerMethodKey, g.R.Method), slog.String("path", g.R.URL.Path))
+		g.logger, g.rawLog = RawLogger.With(args...), RawLogger
+	}
+	return g.logger
+}
+
+// headerHasToken returns whether the comma-separated list of header key in h contains token,
+// compared case-insensitively.
+func headerHasToken(h http.Header, key, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isEventStream returns whether the Content-Type of h is text/event-stream.
+func isEventStream(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mediaType == "text/event-stream"
+}
+
+// IsWebSocket returns whether the request is a WebSocket upgrade request,
+// which has "Connection: Upgrade" and "Upgrade: websocket" headers.
+// Middlewares buffering or compressing the response should pass such requests through.
+func (g *Gear) IsWebSocket() bool {
+	return headerHasToken(g.R.Header, "Connection", "upgrade") && headerHasToken(g.R.Header, "Upgrade", "websocket")
+}
+
+// IsEventStream returns whether the response is a server-sent event stream,
+// which has a text/event-stream Content-Type header.
+// The result is meaningful only after the Content-Type header is set by the handler.
+// Middlewares buffering or compressing the response should pass such responses through.
+func (g *Gear) IsEventStream() bool {
+	return isEventStream(g.W.Header())
+}
+
+// Done returns a channel that's closed when the request is canceled, for example the client disconnects,
+// or the server is shutting down. It is a shortcut of g.R.Context().Done().
+// Long-running handlers can select on it alongside their own channels to clean up.
+func (g *Gear) Done() <-chan struct{} {
+	return g.R.Context().Done()
 }
 
 // SetContextValue sets the request context value associated with key to val.
@@ -39,6 +185,25 @@ func (g *Gear) ContextValue(key any) any {
 	return g.R.Context().Value(key)
 }
 
+// Pattern returns the route pattern matched by [http.ServeMux], such as "GET /items/{id}",
+// which is a low-cardinality label for metrics and logging.
+// The http.Request.Pattern field(Go 1.23 or later) set by the mux is used, so the pattern is available
+// in handlers and in middlewares after calling next.
+// Pattern returns "" if there is no matched pattern, or the request has not been routed yet.
+func (g *Gear) Pattern() string {
+	return requestPattern(g.R)
+}
+
+// requestPattern returns the Pattern field of r, which is set by [http.ServeMux] since Go 1.23,
+// or "" if it is not available.
+// The field is read with reflection because the module targets an earlier Go version.
+func requestPattern(r *http.Request) string {
+	if f := reflect.ValueOf(r).Elem().FieldByName("Pattern"); f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
 // Stop stops further middleware processing.
 // Current middleware is unaffected.
 func (g *Gear) Stop() {
@@ -97,7 +262,32 @@ func LogE(msg string, args ...any) {
 	logImpl(slog.LevelError, msg, args...)
 }
 
+// ErrClientGone is wrapped in the errors returned by the response writing methods of Gear, such as
+// [Gear.Write], [Gear.String] and [Gear.JSON], if the client has gone: the connection is broken or reset,
+// or the request is canceled. Such errors are not application errors, check them with errors.Is(err, ErrClientGone).
+var ErrClientGone = errors.New("gear: client gone")
+
+// clientGone returns err wrapped with [ErrClientGone] if err means the client has gone, or err itself otherwise.
+func clientGone(err error) error {
+	if err == nil || errors.Is(err, ErrClientGone) {
+		return err
+	}
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrClientGone, err)
+	}
+	return err
+}
+
+// errLevel returns the level to log err: [slog.LevelDebug] for [ErrClientGone], [slog.LevelError] otherwise.
+func errLevel(err error) slog.Level {
+	if errors.Is(err, ErrClientGone) {
+		return slog.LevelDebug
+	}
+	return slog.LevelError
+}
+
 // LogIfErr logs err at [slog.LevelError] with [RawLogger] if err != nil.
+// Errors wrapping [ErrClientGone] are benign and logged at [slog.LevelDebug].
 // The log message has attribute {"err":err}. LogIfErr returns err.
 // This function is convenient to log non-nil return value.
 // For example:
@@ -105,12 +295,13 @@ func LogE(msg string, args ...any) {
 //	LogIfErr(g.JSON(v))
 func LogIfErr(err error) error {
 	if err != nil {
-		logImpl(slog.LevelError, "", "err", err)
+		logImpl(errLevel(err), "", "err", err)
 	}
 	return err
 }
 
 // LogIfErrT logs ret and err at [slog.LevelError] with [RawLogger] if err != nil.
+// Errors wrapping [ErrClientGone] are benign and logged at [slog.LevelDebug].
 // The log message has attribute {"ret": ret, "err":err}. LogIfErrorT returns err.
 // This function is convenient to log non-nil return value.
 // For example:
@@ -118,7 +309,7 @@ func LogIfErr(err error) error {
 //	LogIfErrT(fmt.Println("msg"))
 func LogIfErrT[T any](ret T, err error) error {
 	if err != nil {
-		logImpl(slog.LevelError, "", "ret", ret, "err", err)
+		logImpl(errLevel(err), "", "ret", ret, "err", err)
 	}
 	return err
 }
@@ -130,24 +321,175 @@ func (g *Gear) DecodeBody(v any) error {
 	return encoding.DecodeBody(g.R, nil, v)
 }
 
+// DecodeBodyWith decodes body using decoder and stores the result in the value pointed to by v,
+// bypassing the decoder selection by Content-Type header.
+// This method is a shortcut of encoding.DecodeBody(g.R, decoder, v).
+// See [encoding.DecodeBody] for more details.
+func (g *Gear) DecodeBodyWith(decoder encoding.BodyDecoder, v any) error {
+	return encoding.DecodeBody(g.R, decoder, v)
+}
+
+// maxBytesBody is a http.MaxBytesReader which records the over-limit error.
+type maxBytesBody struct {
+	io.ReadCloser
+	err *http.MaxBytesError // Non-nil if the limit is exceeded.
+}
+
+func (b *maxBytesBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	if b.err == nil {
+		errors.As(err, &b.err)
+	}
+	return
+}
+
+// DecodeBodyLimit is like [Gear.DecodeBody], but reads at most max bytes of body in this single call,
+// see [http.MaxBytesReader]. If the body is larger than max, the returned error is
+// a *http.MaxBytesError, which can be tested with [errors.As].
+// Different limits can be applied to different decodings, and the body is unlimited after
+// DecodeBodyLimit returns.
+func (g *Gear) DecodeBodyLimit(max int64, v any) error {
+	var orig = g.R.Body
+	var body = &maxBytesBody{ReadCloser: http.MaxBytesReader(g.W, orig, max)}
+	g.R.Body = body
+	defer func() { g.R.Body = orig }()
+	err := encoding.DecodeBody(g.R, nil, v)
+	if body.err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if !errors.As(err, &maxBytesErr) {
+			return body.err // The decoder did not report the read error as is.
+		}
+	}
+	return err
+}
+
+// DecodeJSONValue decodes body as a single JSON value, regardless of Content-Type header,
+// and stores the result in the value pointed to by v.
+// The top-level JSON value can be a scalar(string, number, boolean or null), an array or an object,
+// decoded into v the same way as [encoding/json.Unmarshal], for example a *string, *int, *[]T, *map[string]T or *struct.
+// Structs, including those in slices, arrays and maps, are validated like [Gear.DecodeBody] does.
+// Scalars can't be validated and are always considered valid.
+func (g *Gear) DecodeJSONValue(v any) error {
+	return encoding.DecodeBody(g.R, encoding.JSONBodyDecoder, v)
+}
+
+// DecodeDiscriminated decodes body as a JSON object whose concrete type is selected from registry
+// by the value of field, and returns a pointer to the decoded value.
+// This method is a shortcut of encoding.DecodeDiscriminated(g.R.Body, field, registry).
+// See [encoding.DecodeDiscriminated] for more details.
+func (g *Gear) DecodeDiscriminated(field string, registry map[string]func() any) (any, error) {
+	return encoding.DecodeDiscriminated(g.R.Body, field, registry)
+}
+
+// DecodePatch decodes body as JSON object, stores the result in the value pointed to by v
+// and returns the set of top-level keys present in the body.
+// This method is a shortcut of encoding.DecodeJSONPatch(g.R.Body, v).
+// See [encoding.DecodeJSONPatch] for more details.
+func (g *Gear) DecodePatch(v any) (present map[string]bool, err error) {
+	return encoding.DecodeJSONPatch(g.R.Body, v)
+}
+
+// DecodeNDJSON decodes body as newline-delimited JSON, and calls f with each record decoded into a T,
+// so large imports are processed without buffering them in memory.
+// This function is a shortcut of encoding.DecodeNDJSON(g.R.Body, f).
+// See [encoding.DecodeNDJSON] for more details.
+//
+//	err := gear.DecodeNDJSON(g, func(item Item) error {
+//		return store.Insert(item)
+//	})
+func DecodeNDJSON[T any](g *Gear, f func(v T) error) error {
+	return encoding.DecodeNDJSON(g.R.Body, f)
+}
+
+// DecodeErrorHandler, if not nil, is called by MustDecode* methods to write the response
+// when decoding fails, instead of writing a plain text http.StatusBadRequest response.
+// For example, JSON APIs can write:
+//
+//	gear.DecodeErrorHandler = func(g *gear.Gear, err error) {
+//		g.JSONResponse(http.StatusBadRequest, map[string]string{"error": err.Error()})
+//	}
+//
+// See [DecodeErrorDetail] for a handler telling the client which field failed.
+// The middleware processing is stopped after DecodeErrorHandler returns.
+var DecodeErrorHandler func(g *Gear, err error)
+
 // mustDecode calls f(g, v). If f returns an error, mustDecode returns it but also
-// writes a http.StatusBadRequest response and stops the middleware processing.
+// writes a http.StatusBadRequest response(see [DecodeErrorHandler]) and stops the middleware processing.
 func mustDecode(g *Gear, f func(g *Gear, v any) (err error), v any) (err error) {
 	if err = f(g, v); err != nil {
-		g.Code(http.StatusBadRequest)
+		if DecodeErrorHandler != nil {
+			DecodeErrorHandler(g, err)
+		} else {
+			g.Code(http.StatusBadRequest)
+		}
 		g.Stop()
 	}
 	return
 }
 
+// DecodeErrorDetailOptions are options for [DecodeErrorDetail].
+// A zero DecodeErrorDetailOptions consists entirely of zero values.
+type DecodeErrorDetailOptions struct {
+	// RedactFields are the names of the fields whose offending values are not sent to the client,
+	// such as passwords and tokens.
+	// Zero value means no field is redacted.
+	RedactFields []string
+	// Message is the value of "error".
+	// Zero value means "invalid value".
+	Message string
+}
+
+// DecodeErrorDetail returns a function which can be used as [DecodeErrorHandler] to tell the client which field failed.
+// If the error is a *[encoding.DecodeFieldError], a http.StatusBadRequest response with JSON body
+// {"field":name,"error":"invalid value","value":value} is written. The "value" is omitted for redacted fields.
+// If the error is a *[json.UnmarshalTypeError] with a field, the response is the same but without "value".
+// Other errors result in a plain text http.StatusBadRequest response.
+// If opt is nil, the default options are used.
+func DecodeErrorDetail(opt *DecodeErrorDetailOptions) func(g *Gear, err error) {
+	var message = "invalid value"
+	var redact []string
+	if opt != nil {
+		if opt.Message != "" {
+			message = opt.Message
+		}
+		redact = opt.RedactFields
+	}
+	return func(g *Gear, err error) {
+		var detail map[string]string
+		var fieldErr *encoding.DecodeFieldError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &fieldErr) {
+			detail = map[string]string{"field": fieldErr.Name, "error": message}
+			if !slices.Contains(redact, fieldErr.Name) {
+				detail["value"] = fieldErr.Value
+			}
+		} else if errors.As(err, &typeErr) && typeErr.Field != "" {
+			detail = map[string]string{"field": typeErr.Field, "error": message}
+		} else {
+			g.Code(http.StatusBadRequest)
+			return
+		}
+		g.W.Header().Set("Content-Type", encoding.MIME_JSON)
+		LogIfErr(g.JSONResponse(http.StatusBadRequest, detail))
+	}
+}
+
 // MustDecodeBody calls [Gear.DecodeBody]. If DecodeBody returns an error, MustDecodeBody returns it but also
 // writes a http.StatusBadRequest response and stops the middleware processing.
 func (g *Gear) MustDecodeBody(v any) (err error) {
 	return mustDecode(g, (*Gear).DecodeBody, v)
 }
 
-// DecodeFrom calls g.R.ParseForm(), decodes g.R.Form and stores the result in the value pointed by v.
-// See [encoding.DecodeForm] for more details.
+// MustDecodeBodyWith calls [Gear.DecodeBodyWith]. If DecodeBodyWith returns an error, MustDecodeBodyWith returns it but also
+// writes a http.StatusBadRequest response and stops the middleware processing.
+func (g *Gear) MustDecodeBodyWith(decoder encoding.BodyDecoder, v any) (err error) {
+	return mustDecode(g, func(g *Gear, v any) error { return g.DecodeBodyWith(decoder, v) }, v)
+}
+
+// DecodeForm calls g.R.ParseForm(), decodes g.R.Form and stores the result in the value pointed by v.
+// g.R.Form contains both the URL query and the body values, and the body values take precedence
+// for non-slice fields. Use [Gear.DecodePostForm] to decode the body values only, or [Gear.DecodeQuery]
+// to decode the query only. See [encoding.DecodeForm] for more details.
 // Call ParseMultipartForm() of the request to include values in multi-part form.
 func (g *Gear) DecodeForm(v any) error {
 	LogIfErr(g.R.ParseForm())
@@ -160,10 +502,42 @@ func (g *Gear) MustDecodeForm(v any) (err error) {
 	return mustDecode(g, (*Gear).DecodeForm, v)
 }
 
-// DecodeHeader decodes g.R.Header and stores the result in the value pointed by v.
+// DecodePostForm calls g.R.ParseForm(), decodes g.R.PostForm, the body values without the URL query,
+// and stores the result in the value pointed by v, so handlers can tell body fields from query fields.
+// See [encoding.DecodePostForm] for more details.
+func (g *Gear) DecodePostForm(v any) error {
+	LogIfErr(g.R.ParseForm())
+	return encoding.DecodePostForm(g.R, nil, v)
+}
+
+// MustDecodePostForm calls [Gear.DecodePostForm]. If DecodePostForm returns an error, MustDecodePostForm returns it but also
+// writes a http.StatusBadRequest response and stops the middleware processing.
+func (g *Gear) MustDecodePostForm(v any) (err error) {
+	return mustDecode(g, (*Gear).DecodePostForm, v)
+}
+
+// DecodeMultipartForm calls g.R.ParseMultipartForm(maxMemory), decodes g.R.Form and stores the result in the value pointed by v.
+// At most maxMemory bytes of the file parts are stored in memory, the remainder is stored on disk in temporary files,
+// see [http.Request.ParseMultipartForm]. Non-file parts are always stored in memory.
+// A body which is not multipart is not an error, the URL query and the url-encoded body are decoded as [Gear.DecodeForm] does.
 // See [encoding.DecodeForm] for more details.
+func (g *Gear) DecodeMultipartForm(maxMemory int64, v any) error {
+	if err := g.R.ParseMultipartForm(maxMemory); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	return encoding.DecodeForm(g.R, nil, v)
+}
+
+// MustDecodeMultipartForm calls [Gear.DecodeMultipartForm]. If DecodeMultipartForm returns an error, MustDecodeMultipartForm returns it but also
+// writes a http.StatusBadRequest response and stops the middleware processing.
+func (g *Gear) MustDecodeMultipartForm(maxMemory int64, v any) (err error) {
+	return mustDecode(g, func(g *Gear, v any) error { return g.DecodeMultipartForm(maxMemory, v) }, v)
+}
+
+// DecodeHeader decodes g.R.Header using [encoding.HeaderDecoder] and stores the result in the value pointed by v.
+// See [encoding.DecodeHeader] for more details.
 func (g *Gear) DecodeHeader(v any) error {
-	return encoding.DecodeHeader(g.R, encoding.HeaderDecoder, v)
+	return encoding.DecodeHeader(g.R, nil, v)
 }
 
 // MustDecodeHeader calls [Gear.DecodeHeader]. If DecodeHeader returns an error, MustDecodeHeader returns it but also
@@ -172,10 +546,10 @@ func (g *Gear) MustDecodeHeader(v any) (err error) {
 	return mustDecode(g, (*Gear).DecodeHeader, v)
 }
 
-// DecodeQuery decodes r.URL.Query() and stores the result in the value pointed by v.
-// See [encoding.DecodeForm] for more details.
+// DecodeQuery decodes r.URL.Query() using [encoding.QueryDecoder] and stores the result in the value pointed by v.
+// See [encoding.DecodeQuery] for more details.
 func (g *Gear) DecodeQuery(v any) error {
-	return encoding.DecodeQuery(g.R, encoding.HeaderDecoder, v)
+	return encoding.DecodeQuery(g.R, nil, v)
 }
 
 // MustDecodeQuery calls [Gear.DecodeQuery]. If DecodeQuery returns an error, MustDecodeHeader returns it but also
@@ -184,28 +558,218 @@ func (g *Gear) MustDecodeQuery(v any) (err error) {
 	return mustDecode(g, (*Gear).DecodeQuery, v)
 }
 
+// checkHeader logs a warning if the response header has already been written,
+// in which case modifying the header has no effect.
+func (g *Gear) checkHeader(op, key string) {
+	if written, _ := headerWritten(g.W); written {
+		LogW("gear: response header modified after written", "op", op, "key", key)
+	}
+}
+
+// SetHeader sets the response header entry associated with key to value, and returns g for chaining.
+// Setting the header after it has been written has no effect, and a warning is logged if
+// that can be detected.
+func (g *Gear) SetHeader(key, value string) *Gear {
+	g.checkHeader("set", key)
+	g.W.Header().Set(key, value)
+	return g
+}
+
+// AddHeader adds value to the response header entry associated with key, and returns g for chaining.
+// See [Gear.SetHeader].
+func (g *Gear) AddHeader(key, value string) *Gear {
+	g.checkHeader("add", key)
+	g.W.Header().Add(key, value)
+	return g
+}
+
+// SetHeaders sets the response header entries to all the values in h, and returns g for chaining.
+// Entries in the response header not in h are unaffected. See [Gear.SetHeader].
+func (g *Gear) SetHeaders(h http.Header) *Gear {
+	var header = g.W.Header()
+	for key, values := range h {
+		g.checkHeader("set", key)
+		header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+	return g
+}
+
+// CacheControl sets Cache-Control header of the response to allow caching for maxAge, rounded down to seconds,
+// and a matching Expires header for HTTP/1.0 caches. If public is true, the response can be stored by shared
+// caches such as CDNs and proxies, otherwise only by the browser, which is required for responses containing
+// private data. A maxAge not greater than zero means the response is stale immediately.
+// Use [Gear.NoStore] to prevent caching entirely.
+func (g *Gear) CacheControl(maxAge time.Duration, public bool) {
+	var seconds = max(int64(maxAge/time.Second), 0)
+	var scope = "private"
+	if public {
+		scope = "public"
+	}
+	g.SetHeader("Cache-Control", scope+", max-age="+strconv.FormatInt(seconds, 10))
+	g.SetHeader("Expires", time.Now().Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+}
+
+// NoStore sets Cache-Control header of the response to "no-store", so it is not stored by any cache,
+// which is required for sensitive responses, and removes Expires header.
+func (g *Gear) NoStore() {
+	g.SetHeader("Cache-Control", "no-store")
+	g.W.Header().Del("Expires")
+}
+
+// SetTrailer sets the response trailer associated with key to value, which is sent after the body,
+// such as the status of a streaming response or a checksum of the body, and returns g for chaining.
+// Unlike headers, trailers can be set after the body is written, until the handler returns.
+// If the header has not been written, or that can't be detected, the trailer is also declared
+// in Trailer header. Trailers are only sent by HTTP/1.1 chunked and HTTP/2 responses.
+func (g *Gear) SetTrailer(key, value string) *Gear {
+	key = http.CanonicalHeaderKey(key)
+	var header = g.W.Header()
+	if written, _ := headerWritten(g.W); !written && !slices.Contains(trailerKeys(header), key) {
+		header.Add("Trailer", key)
+	}
+	header.Set(http.TrailerPrefix+key, value)
+	return g
+}
+
+// ReplayHeaders copies all the values of the response header of g.W to the header of dst,
+// replacing the values of the same keys in dst. Multi-valued headers such as Set-Cookie are
+// copied entirely, unlike copying with [http.Header.Set].
+// Middlewares buffering the response can call it, while g.W is the buffering writer,
+// to replay the header to the underlying writer dst before writing the status code and body.
+func (g *Gear) ReplayHeaders(dst http.ResponseWriter) {
+	copyHeader(dst.Header(), g.W.Header())
+}
+
 // Code writes code and status text using http.Code().
 func (g *Gear) Code(code int) {
 	http.Error(g.W, http.StatusText(code), code)
 }
 
 // Write copies data from r to the response.
+// The copy is aborted if the context of g.R is done, and the context error is returned.
+// If the client has gone, the error returned wraps [ErrClientGone].
 func (g *Gear) Write(r io.Reader) error {
-	_, err := io.Copy(g.W, r)
-	return err
+	_, err := copyContext(g.R.Context(), g.W, r)
+	return clientGone(err)
+}
+
+// isAttrChar returns whether c is an attr-char of RFC 5987, which needs no percent-encoding.
+func isAttrChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// contentDisposition returns the value of Content-Disposition header of an attachment named filename.
+// Non-ASCII filename is encoded as RFC 5987 filename* parameter, along with an ASCII fallback filename
+// parameter for old clients.
+func contentDisposition(filename string) string {
+	var ascii = true
+	var fallback = make([]byte, 0, len(filename))
+	for i := 0; i < len(filename); i++ {
+		switch c := filename[i]; {
+		case c >= 0x80 || c < 0x20 || c == 0x7f:
+			ascii = false
+			fallback = append(fallback, '_')
+		case c == '"' || c == '\\':
+			fallback = append(fallback, '\\', c)
+		default:
+			fallback = append(fallback, c)
+		}
+	}
+	var value = `attachment; filename="` + string(fallback) + `"`
+	if ascii {
+		return value
+	}
+	const hex = "0123456789ABCDEF"
+	var encoded = make([]byte, 0, len(filename)*3)
+	for i := 0; i < len(filename); i++ {
+		if c := filename[i]; isAttrChar(c) {
+			encoded = append(encoded, c)
+		} else {
+			encoded = append(encoded, '%', hex[c>>4], hex[c&0xf])
+		}
+	}
+	return value + "; filename*=UTF-8''" + string(encoded)
+}
+
+// Attachment writes a file download named filename with content read from r.
+// The Content-Disposition header is set to attachment with filename, non-ASCII filename is encoded
+// as specified in RFC 5987. The Content-Type header is set to contentType, or the type determined
+// by the extension of filename if contentType is empty, or "application/octet-stream" if unknown.
+// The copy is aborted if the context of g.R is done, and the context error is returned.
+func (g *Gear) Attachment(r io.Reader, filename string, contentType string) error {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	var header = g.W.Header()
+	header.Set("Content-Disposition", contentDisposition(filename))
+	header.Set("Content-Type", contentType)
+	return g.Write(r)
+}
+
+// Stream writes each chunk received from ch to the response and flushes it,
+// until ch is closed or the context of g.R is done, in which case the context error is returned.
+// If the client has gone, the error returned wraps [ErrClientGone].
+// The response writer must support flushing(see [http.ResponseController]),
+// or Stream returns an error wrapping [http.ErrNotSupported] before writing anything.
+func (g *Gear) Stream(ch <-chan []byte) error {
+	var rc = http.NewResponseController(g.W)
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+	var done = g.R.Context().Done()
+	for {
+		select {
+		case <-done:
+			return clientGone(g.R.Context().Err())
+		case chunk, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if _, err := g.W.Write(chunk); err != nil {
+				return clientGone(err)
+			}
+			if err := rc.Flush(); err != nil {
+				return clientGone(err)
+			}
+		}
+	}
+}
+
+// contextReader is an io.Reader which fails with ctx.Err() once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read implements [io.Reader]. ctx.Err() is checked before reading.
+func (r contextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	return r.r.Read(p)
+}
+
+// copyContext copies from src to dst until either EOF is reached on src, an error occurs
+// or ctx is done. ctx.Err() is checked between chunks.
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (written int64, err error) {
+	return io.Copy(dst, contextReader{ctx, src})
 }
 
 // String writes and body to the response.
 func (g *Gear) String(body string) error {
 	_, err := io.WriteString(g.W, body)
-	return err
+	return clientGone(err)
 }
 
 // StringResponse writes code and body to the response.
 func (g *Gear) StringResponse(code int, body string) error {
 	g.W.WriteHeader(code)
 	_, err := io.WriteString(g.W, body)
-	return err
+	return clientGone(err)
 }
 
 // StringResponsef writes code and then call fmt.Fprintf() to write the formated string.
@@ -215,23 +779,82 @@ func (g *Gear) StringResponsef(code int, format string, a ...any) error {
 	g.W.Header().Set("X-Content-Type-Options", "nosniff")
 	g.W.WriteHeader(code)
 	_, err := fmt.Fprintf(g.W, format+"\n", a...)
-	return err
+	return clientGone(err)
 }
 
 // JSON writes JSON encoding of v to the response.
+// Nothing is written if the encoding fails, see [encoding.EncodeJSON].
 func (g *Gear) JSON(v any) error {
-	return encoding.EncodeJSON(v, g.W)
+	return clientGone(encoding.EncodeJSON(v, g.W))
 }
 
 // JSONResponse writes code and JSON encoding of v to the response.
+// v is encoded into a buffer first, and nothing, including code, is written if the encoding fails,
+// so the caller can still send a proper status.
 func (g *Gear) JSONResponse(code int, v any) error {
+	var buf bytes.Buffer
+	if err := encoding.EncodeJSON(v, &buf); err != nil {
+		return err
+	}
 	g.W.WriteHeader(code)
-	return g.JSON(v)
+	_, err := buf.WriteTo(g.W)
+	return clientGone(err)
+}
+
+// JSONUnbuffered writes JSON encoding of v to the response without buffering.
+// It is suitable for large payloads, but partial data may have been written if the encoding fails.
+// See [encoding.EncodeJSONStream].
+func (g *Gear) JSONUnbuffered(v any) error {
+	return clientGone(encoding.EncodeJSONStream(v, g.W))
+}
+
+// MustJSON writes JSON encoding of v to the response.
+// v is encoded into a buffer first and nothing is written if the encoding fails,
+// in which case MustJSON logs the error, writes a http.StatusInternalServerError response
+// and stops the middleware processing.
+func (g *Gear) MustJSON(v any) {
+	mustJSON(g, 0, v)
+}
+
+// MustJSONResponse writes code and JSON encoding of v to the response.
+// See [Gear.MustJSON] for how encoding failure is handled.
+func (g *Gear) MustJSONResponse(code int, v any) {
+	mustJSON(g, code, v)
+}
+
+// mustJSON encodes v into a buffer and then writes code(if not 0) and the buffer to the response.
+// If the encoding fails, mustJSON logs the error, writes a http.StatusInternalServerError
+// response and stops the middleware processing.
+func mustJSON(g *Gear, code int, v any) {
+	var buf bytes.Buffer
+	if LogIfErr(encoding.EncodeJSON(v, &buf)) != nil {
+		g.Code(http.StatusInternalServerError)
+		g.Stop()
+		return
+	}
+	if code != 0 {
+		g.W.WriteHeader(code)
+	}
+	_, err := g.W.Write(buf.Bytes())
+	LogIfErr(clientGone(err))
+}
+
+// Protobuf writes protobuf encoding of v to the response with Content-Type header set to [encoding.MIME_X_PROTOBUF].
+// v must implement [encoding.ProtoMessage]. Nothing is written if the encoding fails.
+// See [encoding.EncodeProtobuf].
+func (g *Gear) Protobuf(v any) error {
+	var buf bytes.Buffer
+	if err := encoding.EncodeProtobuf(v, &buf); err != nil {
+		return err
+	}
+	g.W.Header().Set("Content-Type", encoding.MIME_X_PROTOBUF)
+	_, err := buf.WriteTo(g.W)
+	return clientGone(err)
 }
 
 // XML writes XML encoding of v to the response.
 func (g *Gear) XML(v any) error {
-	return encoding.EncodeXML(v, g.W)
+	return clientGone(encoding.EncodeXML(v, g.W))
 }
 
 // XMLResponse writes code and JSON encoding of v to the response.
@@ -240,6 +863,33 @@ func (g *Gear) XMLResponse(code int, v any) error {
 	return g.XML(v)
 }
 
+// ErrPathTraversal is returned by [Gear.ServeFile] if the file name is not local to the root directory.
+var ErrPathTraversal = errors.New("gear: invalid file name, not local to the root")
+
+// ServeFile replies to the request with the contents of the named file or directory in root directory
+// using [http.ServeFile], which supports byte-range and conditional requests.
+// name is slash-separated and relative to root. To guard against directory traversal when name
+// comes from user input, ServeFile rejects the names escaping root(see [filepath.IsLocal]),
+// such as absolute paths and the ones containing ".." elements that go above root,
+// writes a http.StatusBadRequest response and returns [ErrPathTraversal].
+// Note that symbolic links in root are followed.
+func (g *Gear) ServeFile(root, name string) error {
+	name = filepath.FromSlash(name)
+	if !filepath.IsLocal(name) {
+		g.Code(http.StatusBadRequest)
+		return ErrPathTraversal
+	}
+	http.ServeFile(g.W, g.R, filepath.Join(root, name))
+	return nil
+}
+
+// ServeContent replies to the request using the content in the provided ReadSeeker
+// using [http.ServeContent], which supports byte-range and conditional requests.
+// See [http.ServeContent] for the meaning of name and modtime.
+func (g *Gear) ServeContent(name string, modtime time.Time, content io.ReadSeeker) {
+	http.ServeContent(g.W, g.R, name, modtime, content)
+}
+
 // G retrives the Gear in r. It panics if no Gear.
 func G(r *http.Request) *Gear {
 	if g := getGear(r); g == nil {
@@ -253,6 +903,33 @@ func getGear(r *http.Request) any {
 	return r.Context().Value(ctxKey)
 }
 
+// StripPrefix is like [http.StripPrefix], but gear-aware. If the request carries a [Gear],
+// g.R is replaced with the stripped request(see [Gear.SetRequest]) while handler serves it,
+// so a gear-wrapped handler(see [Wrap]) mounted under prefix sees the stripped path,
+// and g.R is restored after handler returns.
+func StripPrefix(prefix string, handler http.Handler) http.Handler {
+	return http.StripPrefix(prefix, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		val := getGear(r)
+		if val == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		g := val.(*Gear)
+		orig := g.R
+		g.SetRequest(r)
+		defer g.SetRequest(orig)
+		handler.ServeHTTP(w, g.R)
+	}))
+}
+
+// newGear returns a new Gear of w and r, which is added to the context of g.R.
+func newGear(w http.ResponseWriter, r *http.Request) *Gear {
+	g := &Gear{W: w}
+	ctx := context.WithValue(r.Context(), ctxKey, g)
+	g.R = r.WithContext(ctx)
+	return g
+}
+
 // Wrap wraps handler and adds Gear to it.
 // If handler is nil, http.DefaultServeMux will be used.
 // Parameter middlewares will be added to the result Handler.
@@ -262,20 +939,48 @@ func Wrap(handler http.Handler, middlewares ...Middleware) http.Handler {
 	if handler == nil {
 		handler = http.DefaultServeMux
 	}
+	return wrap(handler, middlewares)
+}
+
+// wrap is the implementation of [Wrap], without the nil handler check.
+func wrap(handler http.Handler, middlewares []Middleware) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var g *Gear
 		if val := getGear(r); val != nil {
 			g = val.(*Gear)
 		} else {
-			// Add gear.
-			g = &Gear{W: w}
-			ctx := context.WithValue(r.Context(), ctxKey, g)
-			g.R = r.WithContext(ctx)
+			g = newGear(w, r)
 		}
 		newMwExec(middlewares, handler).exec(g)
 	})
 }
 
+// WrapWithNotFound is like [Wrap], but notFound serves the request instead, if handler responds
+// http.StatusNotFound with an empty body or the default body of [http.NotFound], which is the case
+// when nothing matches in [http.ServeMux]. So the 404 responses are consistent app-wide without
+// replacing the mux. The 404 responses with other bodies, written by handler on purpose, are kept.
+// The header set by handler is discarded before notFound serves the request.
+func WrapWithNotFound(handler http.Handler, notFound http.Handler, middlewares ...Middleware) http.Handler {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	return wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var g = G(r)
+		var header = w.Header().Clone()
+		var nw = &notFoundWriter{ResponseWriter: w}
+		func() {
+			g.W = nw
+			defer func() { g.W = w }()
+			handler.ServeHTTP(nw, r)
+		}()
+		if nw.held {
+			clear(w.Header())
+			copyHeader(w.Header(), header)
+			notFound.ServeHTTP(w, g.R)
+		}
+	}), middlewares)
+}
+
 // WrapFunc wraps f to a handler and adds Gear to it.
 // If f is nil, http.DefaultServeMux.ServeHTTP will be used.
 // Parameter middlewares will be added to the result Handler.
@@ -311,11 +1016,21 @@ func NewTestServer(handler http.Handler, middlewares ...Middleware) *httptest.Se
 	return httptest.NewServer(Wrap(handler, middlewares...))
 }
 
+// NewTestGear returns a new Gear around w and r for unit tests, without running a server.
+// [G] of g.R returns g, so the handler logic using Gear can be called directly
+// with a [httptest.ResponseRecorder] and a request created by [httptest.NewRequest]:
+//
+//	w := httptest.NewRecorder()
+//	g := gear.NewTestGear(w, httptest.NewRequest(http.MethodGet, "/?n=1", nil))
+//	handler(g.W, g.R)
+func NewTestGear(w http.ResponseWriter, r *http.Request) *Gear {
+	return newGear(w, r)
+}
+
 // PathInterceptor is a [Middleware] intercepting requests with matching URLs.
 type PathInterceptor struct {
-	prefix      string
-	prefixSlash string
-	handler     Middleware
+	match   func(urlPath string) bool
+	handler Middleware
 }
 
 // NewPathInterceptor returns a [PathInterceptor] which executes handler when the
@@ -327,15 +1042,65 @@ func NewPathInterceptor(prefix string, handler Middleware) *PathInterceptor {
 		pathSlash += "/"
 	}
 	return &PathInterceptor{
-		prefix,
-		pathSlash,
+		func(urlPath string) bool {
+			return urlPath == prefix || strings.HasPrefix(urlPath, pathSlash)
+		},
 		handler,
 	}
 }
 
+// NewPatternInterceptor returns a [PathInterceptor] which executes handler when the
+// path of request URL matches pattern.
+// If pattern starts with "^", it is a regular expression(see [regexp.Compile]) matched against the path.
+// Otherwise, pattern is a glob(see [path.Match]). A glob without "/", such as "*.json",
+// is matched against the last element of the path. A glob with "/", such as "/api/v*/admin",
+// is matched against the path and all its parent paths, so "/api/v1/admin" and all paths
+// starts with "/api/v1/admin/" are intercepted, like [NewPathInterceptor] does.
+// A non-nil error is returned if pattern is malformed.
+func NewPatternInterceptor(pattern string, handler Middleware) (*PathInterceptor, error) {
+	if strings.HasPrefix(pattern, "^") {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &PathInterceptor{re.MatchString, handler}, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if !strings.Contains(pattern, "/") {
+		return &PathInterceptor{
+			func(urlPath string) bool {
+				matched, _ := path.Match(pattern, path.Base(urlPath))
+				return matched
+			},
+			handler,
+		}, nil
+	}
+	pattern = path.Clean(pattern)
+	var depth = strings.Count(pattern, "/")
+	return &PathInterceptor{
+		func(urlPath string) bool {
+			// Cut urlPath to the same number of elements as pattern.
+			var i, n = 0, 0
+			for ; i < len(urlPath); i++ {
+				if urlPath[i] == '/' {
+					if n == depth {
+						break
+					}
+					n++
+				}
+			}
+			matched, _ := path.Match(pattern, urlPath[:i])
+			return matched
+		},
+		handler,
+	}, nil
+}
+
 // Serve implements Serve() method of [Middleware].
 func (m *PathInterceptor) Serve(g *Gear, next func(*Gear)) {
-	if g.R.URL.Path == m.prefix || strings.HasPrefix(g.R.URL.Path, m.prefixSlash) {
+	if m.match(g.R.URL.Path) {
 		m.handler.Serve(g, next)
 	}
 	next(g)
@@ -346,6 +1111,7 @@ type Group struct {
 	mux         *http.ServeMux
 	prefix      string
 	middlewares []Middleware
+	recovery    Middleware // See Group.Recover.
 }
 
 // NewGroup create a prefix of URLs on mux. When any URL has the prefix is requested,
@@ -355,7 +1121,17 @@ func NewGroup(prefix string, mux *http.ServeMux, middlewares ...Middleware) *Gro
 	if mux == nil {
 		mux = http.DefaultServeMux
 	}
-	return &Group{mux, prefix, middlewares}
+	return &Group{mux, prefix, middlewares, nil}
+}
+
+// chain returns the middlewares to wrap a handler registered to group with.
+// Group middlewares take precedence over middlewares, and the recovery middleware
+// takes precedence over all of them.
+func (group *Group) chain(middlewares []Middleware) []Middleware {
+	if group.recovery == nil {
+		return slices.Concat(middlewares, group.middlewares)
+	}
+	return slices.Concat(middlewares, group.middlewares, []Middleware{group.recovery})
 }
 
 // emptyHttpHandler is a http.Handler does nothing.
@@ -363,15 +1139,15 @@ var emptyHttpHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Requ
 
 // Handle registers handler for a pattern which is the group prefix joined ([path.Join]) pattern parameter.
 // The handler and middlewares are wrapped(see [Wrap]) before registering.
-// Group's middlewares take precedence over the wrapped handler here.
+// Group's middlewares take precedence over the wrapped handler here,
+// and the recovery middleware(see [Group.Recover]) takes precedence over all of them.
 // If handler is nil, an empty handler will be used.
 func (group *Group) Handle(pattern string, handler http.Handler, middlewares ...Middleware) *Group {
 	if handler == nil {
 		handler = emptyHttpHandler
 	}
 	group.mux.Handle(path.Join(group.prefix, pattern),
-		Wrap(handler,
-			append(middlewares, group.middlewares...)...)) // group middlewares take precedence.
+		Wrap(handler, group.chain(middlewares)...))
 	return group
 }
 
@@ -380,6 +1156,42 @@ func (group *Group) HandleFunc(pattern string, f func(w http.ResponseWriter, r *
 	return group.Handle(pattern, http.HandlerFunc(f), middlewares...)
 }
 
+// Mount registers handler for all the paths under the group prefix joined ([path.Join]) prefix parameter.
+// Unlike [Group.Handle], which registers a single pattern, Mount matches all sub-paths.
+// The joined prefix is stripped from the request URL path(see [StripPrefix]) before
+// handler is called, so handler can be an independently-built module such as another [http.ServeMux].
+// The handler is wrapped(see [Wrap]) with the group middlewares, which see the unstripped path.
+func (group *Group) Mount(prefix string, handler http.Handler) *Group {
+	var full = path.Join(group.prefix, prefix)
+	var pattern = full
+	if !strings.HasSuffix(pattern, "/") {
+		pattern += "/"
+	}
+	group.mux.Handle(pattern, Wrap(StripPrefix(strings.TrimSuffix(full, "/"), handler), group.chain(nil)...))
+	return group
+}
+
+// With creates a new group with the same prefix and mux as group, and additional middlewares.
+// Like [Group.Group], middlewares of group handle the request before the new group.
+// Group is unaffected.
+func (group *Group) With(middlewares ...Middleware) *Group {
+	return &Group{
+		group.mux,
+		group.prefix,
+		append(middlewares, group.middlewares...), // parent group takes precedence.
+		group.recovery,
+	}
+}
+
+// Use appends middlewares to the middlewares of group. Like [Wrap], middlewares will be
+// served in reversed order of addition.
+// Use only affects the handlers registered afterward, already-registered handlers
+// and child groups are unaffected.
+func (group *Group) Use(middlewares ...Middleware) *Group {
+	group.middlewares = append(slices.Clip(group.middlewares), middlewares...)
+	return group
+}
+
 // Group creates a new URL prefix: path.Join(parent.prefix, prefix).
 // When any URL has the prefix is requested, middlewares of parent group
 // handle the request before the new group.
@@ -388,5 +1200,19 @@ func (parent *Group) Group(prefix string, middlewares ...Middleware) *Group {
 		parent.mux,
 		path.Join(parent.prefix, prefix),
 		append(middlewares, parent.middlewares...), // parent group takes precedence.
+		parent.recovery,
 	}
 }
+
+// Recover sets the recovery middleware of group, typically [PanicRecovery] or a custom one
+// rendering an error page, and returns group.
+// Unlike a recovery middleware added with other group middlewares, which can't catch panics
+// in the group middlewares served before it, the recovery middleware always takes precedence
+// over all the middlewares of group(including the ones inherited from parent groups), so it
+// wraps the entire group. Child groups created afterward inherit the recovery middleware,
+// and can replace it by calling Recover on themselves.
+// Like [Group.Use], Recover only affects the handlers registered afterward.
+func (group *Group) Recover(recovery Middleware) *Group {
+	group.recovery = recovery
+	return group
+}
@@ -2,22 +2,32 @@ package gear_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/mkch/gear"
 	"github.com/mkch/gear/encoding"
 	"github.com/mkch/gear/internal/geartest"
+	"github.com/mkch/gear/validator"
 	"github.com/mkch/gg"
 )
 
@@ -160,10 +170,10 @@ func TestPanicRecover(t *testing.T) {
 		panic("some error")
 	})
 
-	geartest.Curl(server.URL + "/error")
+	geartest.Curl(server.URL+"/error", "-H", gear.RequestIDHeader+": abc")
 	geartest.Curl(server.URL)
 
-	if output := w.String(); !strings.HasSuffix(output, `level=ERROR msg="recovered from panic" value="some error"`+"\n") {
+	if output := w.String(); !strings.HasSuffix(output, `level=ERROR msg="recovered from panic" value="some error" method=GET URL=/error request_id=abc`+"\n") {
 		t.Fatal(output)
 	}
 
@@ -200,6 +210,45 @@ func TestPathInterceptor(t *testing.T) {
 	}
 }
 
+func TestPatternInterceptor(t *testing.T) {
+	handler := gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		io.WriteString(g.W, "intercepted")
+		g.Stop()
+	})
+	var tests = []struct {
+		pattern     string
+		path        string
+		intercepted bool
+	}{
+		{"*.json", "/a/b.json", true},
+		{"*.json", "/a/b.xml", false},
+		{"/api/v*/admin", "/api/v1/admin", true},
+		{"/api/v*/admin", "/api/v2/admin/users", true},
+		{"/api/v*/admin", "/api/v1/user", false},
+		{"/api/v*/admin", "/api/v1", false},
+		{`^/users/\d+$`, "/users/12", true},
+		{`^/users/\d+$`, "/users/me", false},
+	}
+	for _, test := range tests {
+		interceptor, err := gear.NewPatternInterceptor(test.pattern, handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {}, interceptor).
+			ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if intercepted := w.Body.String() == "intercepted"; intercepted != test.intercepted {
+			t.Fatal(test)
+		}
+	}
+	if _, err := gear.NewPatternInterceptor("[", handler); err == nil {
+		t.Fatal("should fail")
+	}
+	if _, err := gear.NewPatternInterceptor("^(", handler); err == nil {
+		t.Fatal("should fail")
+	}
+}
+
 func TestGroup(t *testing.T) {
 	var mux http.ServeMux
 
@@ -275,6 +324,29 @@ func TestDecodeForm(t *testing.T) {
 	}
 }
 
+func TestDecodePostForm(t *testing.T) {
+	type Person struct {
+		Name    string   `map:"name"`
+		Hobbies []string `map:"hobby"`
+	}
+	var form, post Person
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		gear.LogIfErr(g.MustDecodeForm(&form))
+		gear.LogIfErr(g.MustDecodePostForm(&post))
+	})
+	resp := geartest.NewClient(handler).Post("/post?name=Query&hobby=football", encoding.MIME_FORM, "name=John&hobby=basketball")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.StatusCode)
+	}
+	if !reflect.DeepEqual(form, Person{Name: "John", Hobbies: []string{"basketball", "football"}}) {
+		t.Fatal(form)
+	}
+	if !reflect.DeepEqual(post, Person{Name: "John", Hobbies: []string{"basketball"}}) {
+		t.Fatal(post)
+	}
+}
+
 type Name struct {
 	First string
 	Last  string
@@ -292,6 +364,30 @@ func (n *Name) UnmarshalMapValue(values []string) error {
 	return nil
 }
 
+func TestDecodeFormUnmarshalerSlice(t *testing.T) {
+	type Team struct {
+		Names  []*Name `map:"name"`
+		Values []Name  `map:"name"`
+	}
+	var team Team
+	r := httptest.NewRequest(http.MethodGet, "/?name=a+b&name=c+d", nil)
+	if err := gear.NewTestGear(httptest.NewRecorder(), r).DecodeForm(&team); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(team, Team{
+		Names:  []*Name{{"a", "b"}, {"c", "d"}},
+		Values: []Name{{"a", "b"}, {"c", "d"}},
+	}) {
+		t.Fatal(team)
+	}
+
+	var fieldErr *encoding.DecodeFieldError
+	r = httptest.NewRequest(http.MethodGet, "/?name=a+b&name=c", nil)
+	if err := gear.NewTestGear(httptest.NewRecorder(), r).DecodeForm(&team); !errors.As(err, &fieldErr) || fieldErr.Value != "c" {
+		t.Fatal(err)
+	}
+}
+
 func TestDecodeFormMultipart(t *testing.T) {
 	type Person struct {
 		Name    *Name    `map:"name"`
@@ -323,6 +419,35 @@ func TestDecodeFormMultipart(t *testing.T) {
 	}
 }
 
+func TestDecodeMultipartForm(t *testing.T) {
+	type Person struct {
+		Name    string   `map:"name"`
+		Hobbies []string `map:"hobby"`
+	}
+	var person Person
+	var mux http.ServeMux
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		person = Person{}
+		gear.G(r).MustDecodeMultipartForm(1024, &person)
+	})
+	client := geartest.NewClient(gear.Wrap(&mux))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "John")
+	mw.WriteField("hobby", "basketball")
+	mw.Close()
+	client.Post("/post?hobby=football", mw.FormDataContentType(), body.String())
+	slices.Sort(person.Hobbies)
+	if !reflect.DeepEqual(person, Person{Name: "John", Hobbies: []string{"basketball", "football"}}) {
+		t.Fatal(person)
+	}
+	client.Post("/post", "application/x-www-form-urlencoded", "name=Jane")
+	if !reflect.DeepEqual(person, Person{Name: "Jane"}) {
+		t.Fatal(person)
+	}
+}
+
 func TestLogger(t *testing.T) {
 	var buf bytes.Buffer
 	withLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
@@ -436,3 +561,1236 @@ func TestEncodeXML(t *testing.T) {
 		t.Fatal(resp)
 	}
 }
+
+func TestWriteContext(t *testing.T) {
+	var content = strings.Repeat("0123456789", 10*1024)
+	var err error
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = gear.G(r).Write(strings.NewReader(content))
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Body.String() != content {
+		t.Fatal(w.Body.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatal(w.Body.Len())
+	}
+}
+
+func TestServeFile(t *testing.T) {
+	var dir = t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file.txt"), []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mux http.ServeMux
+	mux.HandleFunc("/file/{name}", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).ServeFile(dir, r.PathValue("name"))
+	})
+	mux.HandleFunc("/content", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).ServeContent("a.txt", time.Time{}, strings.NewReader("abcdefg"))
+	})
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+
+	if body, vars := geartest.Curl(server.URL+"/file/file.txt", "-r", "2-4"); string(body) != "234" || vars["response_code"] != float64(http.StatusPartialContent) {
+		t.Fatal(string(body), vars["response_code"])
+	}
+	if _, vars := geartest.Curl(server.URL+"/file/..%2F..%2Fetc%2Fpasswd", "--path-as-is"); vars["response_code"] != float64(http.StatusBadRequest) {
+		t.Fatal(vars["response_code"])
+	}
+	if body, vars := geartest.Curl(server.URL+"/content", "-r", "1-2"); string(body) != "bc" || vars["response_code"] != float64(http.StatusPartialContent) {
+		t.Fatal(string(body), vars["response_code"])
+	}
+
+	for _, name := range []string{"/etc/hostname", filepath.Join(dir, "file.txt"), "../file.txt", "a/../../file.txt", ""} {
+		w := httptest.NewRecorder()
+		if err := gear.NewTestGear(w, httptest.NewRequest(http.MethodGet, "/", nil)).ServeFile(dir, name); err != gear.ErrPathTraversal || w.Code != http.StatusBadRequest {
+			t.Fatal(name, err, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	if err := gear.NewTestGear(w, httptest.NewRequest(http.MethodGet, "/", nil)).ServeFile(dir, "a/../file.txt"); err != nil || w.Body.String() != "0123456789" {
+		t.Fatal(err, w.Code, w.Body.String())
+	}
+}
+
+func TestRedirectSlash(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})
+	mux.HandleFunc("/b/{$}", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.Path)
+	})
+
+	server := gear.NewTestServer(&mux, gear.RedirectSlash(gear.AddSlash, &gear.RedirectSlashOptions{Mux: &mux}))
+	defer server.Close()
+	if body, vars := geartest.Curl(server.URL + "/a"); vars["response_code"] != float64(http.StatusOK) || string(body) != "/a" {
+		t.Fatal(vars["response_code"], string(body))
+	}
+	// Not redirected by RedirectSlash, but by http.ServeMux.
+	if _, vars := geartest.Curl(server.URL + "/b?x=1"); vars["response_code"] != float64(http.StatusTemporaryRedirect) || vars["redirect_url"] != server.URL+"/b/?x=1" {
+		t.Fatal(vars["response_code"], vars["redirect_url"])
+	}
+	if _, vars := geartest.Curl(server.URL+"/b", "-X", "POST"); vars["response_code"] != float64(http.StatusTemporaryRedirect) {
+		t.Fatal(vars["response_code"])
+	}
+	if _, vars := geartest.Curl(server.URL + "/c"); vars["response_code"] != float64(http.StatusNotFound) {
+		t.Fatal(vars["response_code"])
+	}
+
+	server2 := gear.NewTestServer(&mux, gear.RedirectSlash(gear.StripSlash, &gear.RedirectSlashOptions{Mux: &mux}))
+	defer server2.Close()
+	if _, vars := geartest.Curl(server2.URL + "/a/?y=2"); vars["response_code"] != float64(http.StatusMovedPermanently) || vars["redirect_url"] != server2.URL+"/a?y=2" {
+		t.Fatal(vars["response_code"], vars["redirect_url"])
+	}
+	if body, _ := geartest.Curl(server2.URL + "/b/"); string(body) != "/b/" {
+		t.Fatal(string(body))
+	}
+
+	// Without a mux, all the non-canonical paths are redirected.
+	client := geartest.NewClient(gear.Wrap(&mux, gear.RedirectSlash(gear.AddSlash, nil)))
+	if resp := client.Get("/a?z=3"); resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/a/?z=3" {
+		t.Fatal(resp.StatusCode, resp.Header)
+	}
+	// Never redirected to another host.
+	for _, path := range []string{"//evil.com", "///evil.com", `/\evil.com`} {
+		if resp := client.Get(path); resp.StatusCode != http.StatusMovedPermanently ||
+			strings.HasPrefix(resp.Header.Get("Location"), "//") || strings.HasPrefix(resp.Header.Get("Location"), `/\`) {
+			t.Fatal(path, resp.StatusCode, resp.Header)
+		}
+	}
+	client = geartest.NewClient(gear.Wrap(&mux, gear.RedirectSlash(gear.StripSlash, nil)))
+	if resp := client.Get("//evil.com/"); resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/evil.com" {
+		t.Fatal(resp.StatusCode, resp.Header)
+	}
+}
+
+func TestGroupUse(t *testing.T) {
+	var mux http.ServeMux
+	var handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "path: %v\n", r.URL.Path)
+	})
+	var mw = func(name string) gear.Middleware {
+		return gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+			fmt.Fprintf(g.W, "%v\n", name)
+			next(g)
+		})
+	}
+
+	group := gear.NewGroup("/a", &mux, mw("m1")).Handle("/1", handler)
+	group.Use(mw("m2")).Handle("/2", handler)
+
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL + "/a/1"); string(body) != "m1\npath: /a/1\n" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL + "/a/2"); string(body) != "m2\nm1\npath: /a/2\n" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestGroupMount(t *testing.T) {
+	var mux http.ServeMux
+	var sub http.ServeMux
+	sub.HandleFunc("/x/y", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "sub: %v\n", r.URL.Path)
+	})
+	gear.NewGroup("/a", &mux, gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		fmt.Fprintf(g.W, "group: %v\n", g.R.URL.Path)
+		next(g)
+	})).Mount("/b", &sub)
+
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL + "/a/b/x/y"); string(body) != "group: /a/b/x/y\nsub: /x/y\n" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL + "/a/b/z"); string(body) != "group: /a/b/z\n404 page not found\n" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	var mux http.ServeMux
+	var inner = gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "inner: %v %v\n", r.URL.Path, gear.G(r).R.URL.Path)
+	}, gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		fmt.Fprintf(g.W, "inner middleware: %v\n", g.R.URL.Path)
+		next(g)
+	}))
+	mux.Handle("/app/", gear.StripPrefix("/app", inner))
+	server := gear.NewTestServer(&mux, gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		next(g)
+		fmt.Fprintf(g.W, "outer: %v\n", g.R.URL.Path)
+	}))
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL + "/app/x"); string(body) != "inner middleware: /x\ninner: /x /x\nouter: /app/x\n" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	var tests = []struct {
+		method   string
+		url      string
+		opt      *gear.CleanPathOptions
+		code     int
+		location string
+		path     string
+	}{
+		{http.MethodGet, "/a//b/../c?x=1", nil, http.StatusMovedPermanently, "/a/c?x=1", ""},
+		{http.MethodGet, "/a/./b/", nil, http.StatusMovedPermanently, "/a/b/", ""},
+		{http.MethodGet, "/A/b", &gear.CleanPathOptions{Lowercase: true}, http.StatusMovedPermanently, "/a/b", ""},
+		{http.MethodGet, "/a/b", nil, http.StatusOK, "", "/a/b"},
+		{http.MethodPost, "/a//b", nil, http.StatusOK, "", "/a/b"},
+	}
+	for _, test := range tests {
+		var p string
+		w := httptest.NewRecorder()
+		gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			p = r.URL.Path
+		}, gear.CleanPath(test.opt)).ServeHTTP(w, httptest.NewRequest(test.method, test.url, nil))
+		if w.Code != test.code || w.Header().Get("Location") != test.location || p != test.path {
+			t.Fatal(test, w.Code, w.Header().Get("Location"), p)
+		}
+	}
+}
+
+func TestDefaultContentType(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/default", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).String("<html></html>")
+	})
+	mux.HandleFunc("/set", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		gear.G(r).String("<html></html>")
+	})
+	server := gear.NewTestServer(&mux, gear.DefaultContentType(encoding.MIME_JSON))
+	defer server.Close()
+	if _, vars := geartest.Curl(server.URL + "/default"); vars["content_type"] != encoding.MIME_JSON {
+		t.Fatal(vars["content_type"])
+	}
+	if _, vars := geartest.Curl(server.URL + "/set"); vars["content_type"] != "text/plain" {
+		t.Fatal(vars["content_type"])
+	}
+}
+
+func TestQueryPath(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/item/{id}", func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		id, err := gear.Path[int64](g, "id")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		page, err := gear.Query[int](g, "page")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		tags, err := gear.Query[[]string](g, "tag")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		missing, err := gear.Query[*int](g, "missing")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var fieldErr *encoding.DecodeFieldError
+		if _, err = gear.Query[float64](g, "bad"); !errors.As(err, &fieldErr) || fieldErr.Name != "bad" {
+			t.Error(err)
+			return
+		}
+		fmt.Fprint(w, id, page, tags, missing)
+	})
+	if resp := geartest.NewClient(gear.Wrap(&mux)).Get("/item/100?page=2&tag=a&tag=b&bad=x"); string(resp.Body) != "100 2 [a b] <nil>" {
+		t.Fatal(string(resp.Body))
+	}
+}
+
+func TestQueryFormParam(t *testing.T) {
+	var body string
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		body = fmt.Sprintf("%v %v %q %v %v",
+			g.QueryParam("a", "def"), g.QueryParam("b", "def"), g.QueryParam("empty", "def"),
+			g.FormParam("c", "def"), g.FormParam("d", "def"))
+	})
+	r := httptest.NewRequest(http.MethodPost, "/?a=1&a=2&empty=", strings.NewReader("c=3"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if body != `1 def "" 3 def` {
+		t.Fatal(body)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		if query := g.Query(); query.Get("a") != "1" {
+			t.Fatal(query)
+		}
+		r2 := g.R.Clone(g.R.Context())
+		r2.URL.RawQuery = "a=2"
+		g.SetRequest(r2)
+		if a, err := gear.Query[int](g, "a"); err != nil || a != 2 {
+			t.Fatal(a, err)
+		}
+	}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?a=1", nil))
+}
+
+func TestDecodePatch(t *testing.T) {
+	type User struct {
+		Name string
+		Age  int
+	}
+	var user = User{"old", 10}
+	var present map[string]bool
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if present, err = gear.G(r).DecodePatch(&user); err != nil {
+			t.Error(err)
+		}
+	})
+	geartest.NewClient(gear.Wrap(&mux)).Request(http.MethodPatch, "/").Body(encoding.MIME_JSON, `{"Age":0}`).Do()
+	if user != (User{"old", 0}) {
+		t.Fatal(user)
+	}
+	if !reflect.DeepEqual(present, map[string]bool{"Age": true}) {
+		t.Fatal(present)
+	}
+}
+
+type badJSON struct{}
+
+func (badJSON) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("bad json")
+}
+
+func TestMustJSON(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).MustJSONResponse(http.StatusCreated, map[string]int{"a": 1})
+	})
+	mux.HandleFunc("/bad", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).MustJSON([]any{1, badJSON{}})
+	})
+	client := geartest.NewClient(gear.Wrap(&mux))
+	if resp := client.Get("/ok"); string(resp.Body) != `{"a":1}`+"\n" || resp.StatusCode != http.StatusCreated {
+		t.Fatal(string(resp.Body), resp.StatusCode)
+	}
+	withLogger(gear.NoLog(), func() {
+		if resp := client.Get("/bad"); string(resp.Body) != http.StatusText(http.StatusInternalServerError)+"\n" || resp.StatusCode != http.StatusInternalServerError {
+			t.Fatal(string(resp.Body), resp.StatusCode)
+		}
+	})
+}
+
+func TestJSONResponseEncodeError(t *testing.T) {
+	var err error
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		if err = g.JSONResponse(http.StatusCreated, []any{1, badJSON{}}); err != nil {
+			g.StringResponse(http.StatusInternalServerError, "failed")
+		}
+	})
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, vars := geartest.Curl(server.URL); string(body) != "failed" || vars["response_code"] != float64(http.StatusInternalServerError) {
+		t.Fatal(string(body), vars["response_code"])
+	}
+	if err == nil {
+		t.Fatal("should fail")
+	}
+}
+
+func TestLoggerExpandURL(t *testing.T) {
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewJSONHandler(&buf, nil)), func() {
+		var mux http.ServeMux
+		server := gear.NewTestServer(&mux, gear.Logger(&gear.LoggerOptions{
+			Keys:      map[string]bool{gear.LoggerURLKey: true},
+			ExpandURL: true}))
+		defer server.Close()
+		geartest.Curl(server.URL + "/a/b?x=y")
+		var line struct {
+			URL map[string]string
+		}
+		if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(line.URL, map[string]string{
+			"path": "/a/b", "query": "x=y", "host": strings.TrimPrefix(server.URL, "http://"), "scheme": "http",
+		}) {
+			t.Fatal(buf.String())
+		}
+	})
+}
+
+func TestStream(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var ch = make(chan []byte)
+		go func() {
+			defer close(ch)
+			for i := 0; i < 3; i++ {
+				ch <- []byte(fmt.Sprintf("chunk%v\n", i))
+			}
+		}()
+		if err := gear.G(r).Stream(ch); err != nil {
+			t.Error(err)
+		}
+	})
+	if resp := geartest.NewClient(gear.Wrap(&mux)).Get("/"); string(resp.Body) != "chunk0\nchunk1\nchunk2\n" {
+		t.Fatal(string(resp.Body))
+	}
+
+	var err error
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = gear.G(r).Stream(make(chan []byte))
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, gear.ErrClientGone) {
+		t.Fatal(err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).Page(http.StatusOK, []int{1, 2}, 11, 2, 5)
+	})
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL); string(body) != `{"data":[1,2],"meta":{"total":11,"page":2,"per_page":5,"total_pages":3}}`+"\n" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestSetRequest(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, gear.G(r).R.URL.Path)
+	})
+	server := gear.NewTestServer(&mux, gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		r := gg.Must(http.NewRequest(g.R.Method, strings.TrimPrefix(g.R.URL.Path, "/a"), nil))
+		g.SetRequest(r)
+		next(g)
+	}))
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL + "/a/b"); string(body) != "/b" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestDecodeBodyWith(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var data struct{ N int }
+		if err := gear.G(r).MustDecodeBodyWith(encoding.JSONBodyDecoder, &data); err != nil {
+			return
+		}
+		fmt.Fprint(w, data.N)
+	})
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, _ := geartest.CurlPOST(server.URL, "text/plain", `{"N":1}`); string(body) != "1" {
+		t.Fatal(string(body))
+	}
+	if _, vars := geartest.CurlPOST(server.URL, "text/plain", `<N>1</N>`); vars["response_code"] != float64(http.StatusBadRequest) {
+		t.Fatal(vars["response_code"])
+	}
+}
+
+func TestGearSetGet(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		v, ok := g.Get("user")
+		_, ok2 := g.Get("missing")
+		fmt.Fprintf(w, "%v %v %v", v, ok, ok2)
+	})
+	server := gear.NewTestServer(&mux, gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		g.Set("user", "u1")
+		g.SetRequest(g.R.Clone(context.Background()))
+		next(g)
+	}))
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL); string(body) != "u1 true false" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestDraining(t *testing.T) {
+	var drain atomic.Bool
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	client := geartest.NewClient(gear.Wrap(&mux, gear.Draining(&drain)))
+	if resp := client.Get("/"); string(resp.Body) != "ok" || resp.Header.Get("Connection") != "" {
+		t.Fatal(string(resp.Body), resp.Header)
+	}
+	drain.Store(true)
+	if resp := client.Get("/"); resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Connection") != "close" {
+		t.Fatal(resp.StatusCode, resp.Header)
+	}
+}
+
+func TestDecodeErrorHandler(t *testing.T) {
+	gear.DecodeErrorHandler = func(g *gear.Gear, err error) {
+		g.JSONResponse(http.StatusUnprocessableEntity, map[string]string{"error": "bad request"})
+	}
+	defer func() { gear.DecodeErrorHandler = nil }()
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var v struct{ N int }
+		gear.G(r).MustDecodeQuery(&v)
+	})
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, vars := geartest.Curl(server.URL + "/?N=x"); string(body) != `{"error":"bad request"}`+"\n" || vars["response_code"] != float64(http.StatusUnprocessableEntity) {
+		t.Fatal(string(body), vars["response_code"])
+	}
+}
+
+func TestDecodeErrorDetail(t *testing.T) {
+	gear.DecodeErrorHandler = gear.DecodeErrorDetail(&gear.DecodeErrorDetailOptions{RedactFields: []string{"Password"}})
+	defer func() { gear.DecodeErrorHandler = nil }()
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var v struct {
+			N        int
+			Password int
+		}
+		gear.G(r).MustDecodeQuery(&v)
+	})
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	var tests = []struct {
+		query string
+		want  string
+	}{
+		{"N=x", `{"error":"invalid value","field":"N","value":"x"}` + "\n"},
+		{"Password=secret", `{"error":"invalid value","field":"Password"}` + "\n"},
+	}
+	for _, test := range tests {
+		if body, vars := geartest.Curl(server.URL + "/?" + test.query); string(body) != test.want || vars["response_code"] != float64(http.StatusBadRequest) {
+			t.Fatal(string(body), vars["response_code"])
+		}
+	}
+}
+
+func TestLoggerSampleRate(t *testing.T) {
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&buf, nil)), func() {
+		var mux http.ServeMux
+		mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+			gear.G(r).Code(http.StatusInternalServerError)
+		})
+		server := gear.NewTestServer(&mux, gear.Logger(&gear.LoggerOptions{
+			Keys:       map[string]bool{gear.LoggerURLKey: true},
+			SampleRate: 1e-9}))
+		defer server.Close()
+		for i := 0; i < 10; i++ {
+			geartest.Curl(server.URL + "/ok")
+		}
+		geartest.Curl(server.URL + "/error")
+		if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 1 || !strings.HasSuffix(lines[0], "URL=/error") {
+			t.Fatal(buf.String())
+		}
+	})
+}
+
+func TestLoggerLevelFunc(t *testing.T) {
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				a = slog.Attr{}
+			}
+			return a
+		},
+	})), func() {
+		var mux http.ServeMux
+		mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+			gear.G(r).Code(http.StatusInternalServerError)
+		})
+		mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+		server := gear.NewTestServer(&mux, gear.Logger(&gear.LoggerOptions{
+			Keys:      map[string]bool{gear.LoggerURLKey: true, gear.LoggerStatusKey: true},
+			LevelFunc: gear.StatusLevel}))
+		defer server.Close()
+		geartest.Curl(server.URL + "/ok")
+		geartest.Curl(server.URL + "/missing")
+		geartest.Curl(server.URL + "/error")
+	})
+	if expected := "level=INFO msg=HTTP URL=/ok status=200\n" +
+		"level=WARN msg=HTTP URL=/missing status=404\n" +
+		"level=ERROR msg=HTTP URL=/error status=500\n"; buf.String() != expected {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggerRoute(t *testing.T) {
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				a = slog.Attr{}
+			}
+			return a
+		},
+	})), func() {
+		var mux http.ServeMux
+		mux.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+		server := gear.NewTestServer(&mux, gear.Logger(&gear.LoggerOptions{
+			Keys: map[string]bool{gear.LoggerURLKey: true, gear.LoggerRouteKey: true}}))
+		defer server.Close()
+		geartest.Curl(server.URL + "/items/1")
+	})
+	if expected := "level=INFO msg=HTTP URL=/items/1 route=/items/{id}\n"; buf.String() != expected {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggerSize(t *testing.T) {
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				a = slog.Attr{}
+			}
+			return a
+		},
+	})), func() {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			io.WriteString(w, "hello")
+		}, gear.Logger(&gear.LoggerOptions{
+			Keys: map[string]bool{gear.LoggerRequestSizeKey: true, gear.LoggerResponseSizeKey: true}}))
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("abc"))
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		r = httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("abcd"))) // Unknown length.
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	})
+	if expected := "level=INFO msg=HTTP request_size=3 response_size=5\n" +
+		"level=INFO msg=HTTP request_size=4 response_size=5\n"; buf.String() != expected {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestLoggerPanic(t *testing.T) {
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				a = slog.Attr{}
+			}
+			return a
+		},
+	})), func() {
+		var w = httptest.NewRecorder()
+		var gw http.ResponseWriter
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oops")
+		}, gear.Logger(&gear.LoggerOptions{Keys: map[string]bool{gear.LoggerStatusKey: true}}),
+			gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+				defer func() {
+					gw = g.W
+					recover()
+				}()
+				next(g)
+			}))
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if gw != w {
+			t.Fatal("writer not restored")
+		}
+	})
+	if expected := "level=INFO msg=HTTP status=500\n"; buf.String() != expected {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestCustomQueryDecoder(t *testing.T) {
+	old := encoding.QueryDecoder
+	defer func() { encoding.QueryDecoder = old }()
+	encoding.QueryDecoder = encoding.NewMapDecoder(&encoding.MapDecoderOptions{IndexedKeys: true})
+
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var query struct {
+			IDs []int `map:"id"`
+		}
+		var header struct {
+			IDs []int `map:"Id"`
+		}
+		g := gear.G(r)
+		if err := g.DecodeQuery(&query); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := g.DecodeHeader(&header); err != nil {
+			t.Error(err)
+			return
+		}
+		fmt.Fprint(w, query.IDs, header.IDs)
+	})
+	if resp := geartest.NewClient(gear.Wrap(&mux)).Request(http.MethodGet, "/?id[1]=2&id[0]=1").Header("Id", "3").Do(); string(resp.Body) != "[1 2] [3]" {
+		t.Fatal(string(resp.Body))
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	var handlerErr error
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handlerErr = func() error {
+			aw, err := gear.G(r).JSONStream()
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 100; i++ {
+				if err := aw.Write(map[string]int{"i": i}); err != nil {
+					return err
+				}
+			}
+			if err := aw.Write(badJSON{}); err == nil {
+				return errors.New("writing bad JSON should fail")
+			}
+			if err := aw.Close(); err != nil {
+				return err
+			}
+			if err := aw.Write(1); err != gear.ErrJSONArrayClosed {
+				return fmt.Errorf("writing after close: %v", err)
+			}
+			return nil
+		}()
+	})
+	resp := geartest.NewClient(gear.Wrap(&mux)).Get("/")
+	if handlerErr != nil {
+		t.Fatal(handlerErr)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != encoding.MIME_JSON {
+		t.Fatal(ct)
+	}
+	var items []map[string]int
+	if err := json.Unmarshal(resp.Body, &items); err != nil {
+		t.Fatal(err, string(resp.Body))
+	}
+	if len(items) != 100 || items[99]["i"] != 99 {
+		t.Fatal(items)
+	}
+}
+
+func TestGroupWith(t *testing.T) {
+	var mux http.ServeMux
+	var handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "path: %v\n", r.URL.Path)
+	})
+	var mw = func(name string) gear.Middleware {
+		return gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+			fmt.Fprintf(g.W, "%v\n", name)
+			next(g)
+		})
+	}
+	group := gear.NewGroup("/a", &mux, mw("base"))
+	group.With(mw("auth")).Handle("/me", handler)
+	group.Handle("/login", handler)
+
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL + "/a/me"); string(body) != "base\nauth\npath: /a/me\n" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL + "/a/login"); string(body) != "base\npath: /a/login\n" {
+		t.Fatal(string(body))
+	}
+}
+
+func TestGroupRecover(t *testing.T) {
+	var mux http.ServeMux
+	var recovery = func(body string) gear.Middleware {
+		return gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+			defer func() {
+				if v := recover(); v != nil {
+					g.StringResponse(http.StatusInternalServerError, fmt.Sprintf("%v: %v", body, v))
+					g.Stop()
+				}
+			}()
+			next(g)
+		})
+	}
+	var panicking = gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		panic("middleware")
+	})
+	api := gear.NewGroup("/api", &mux).Recover(recovery("json"))
+	api.Use(panicking)
+	api.Handle("/a", nil)
+	admin := api.Group("/admin").Recover(recovery("html"))
+	admin.Handle("/b", nil)
+
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	if body, _ := geartest.Curl(server.URL + "/api/a"); string(body) != "json: middleware" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL + "/api/admin/b"); string(body) != "html: middleware" {
+		t.Fatal(string(body))
+	}
+}
+
+type jsonValueItem struct {
+	Name string
+}
+
+// itemValidator validates jsonValueItem only.
+type itemValidator struct{}
+
+func (itemValidator) Struct(s any) error {
+	if item, ok := s.(jsonValueItem); ok && item.Name == "" {
+		return errors.New("name required")
+	}
+	return nil
+}
+
+func (itemValidator) String() string {
+	return "itemValidator"
+}
+
+func TestDecodeJSONValue(t *testing.T) {
+	if validator.Registered() {
+		t.Skip("a validator is registered")
+	}
+	validator.Register(itemValidator{})
+	t.Cleanup(validator.Unregister)
+	decode := func(body string, v any) error {
+		var err error
+		gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			err = gear.G(r).DecodeJSONValue(v)
+		}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		return err
+	}
+
+	var str string
+	if err := decode(`"abc"`, &str); err != nil || str != "abc" {
+		t.Fatal(err, str)
+	}
+	var n int
+	if err := decode(`12`, &n); err != nil || n != 12 {
+		t.Fatal(err, n)
+	}
+	var items []jsonValueItem
+	if err := decode(`[{"Name":"a"}]`, &items); err != nil || !reflect.DeepEqual(items, []jsonValueItem{{"a"}}) {
+		t.Fatal(err, items)
+	}
+	if err := decode(`[{"Name":"a"},{}]`, &items); err == nil {
+		t.Fatal("should fail validation")
+	}
+	var m map[string]*jsonValueItem
+	if err := decode(`{"k":{}}`, &m); err == nil {
+		t.Fatal("should fail validation")
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	w := httptest.NewRecorder()
+	gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).SetHeader("A", "1").AddHeader("B", "2").AddHeader("B", "3").
+			SetHeaders(http.Header{"c": {"4", "5"}})
+	}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if h := w.Header(); h.Get("A") != "1" || !slices.Equal(h["B"], []string{"2", "3"}) || !slices.Equal(h["C"], []string{"4", "5"}) {
+		t.Fatal(h)
+	}
+
+	var log bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&log, nil)), func() {
+		gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			g := gear.G(r)
+			g.String("body")
+			g.SetHeader("A", "1")
+		}, gear.DefaultContentType("text/plain")).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	if !strings.Contains(log.String(), "response header modified after written") {
+		t.Fatal(log.String())
+	}
+}
+
+func TestGearWithContext(t *testing.T) {
+	type key struct{}
+	gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		g.WithContext(context.WithValue(context.Background(), key{}, "v"))
+		if v := g.Context().Value(key{}); v != "v" {
+			t.Fatal(v)
+		}
+		if gear.G(g.R) != g {
+			t.Fatal("gear lost")
+		}
+	}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestPattern(t *testing.T) {
+	var mux http.ServeMux
+	var before, after string
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	client := geartest.NewClient(gear.Wrap(&mux, gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+		before = g.Pattern()
+		next(g)
+		after = g.Pattern()
+	})))
+	client.Get("/items/1")
+	if before != "" || after != "GET /items/{id}" {
+		t.Fatal(before, after)
+	}
+	client.Get("/none")
+	if before != "" || after != "" {
+		t.Fatal(before, after)
+	}
+}
+
+func TestDecodeBodyLimit(t *testing.T) {
+	decode := func(body string, max int64) error {
+		var err error
+		var v map[string]any
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("Content-Type", encoding.MIME_JSON)
+		gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			err = gear.G(r).DecodeBodyLimit(max, &v)
+		}).ServeHTTP(httptest.NewRecorder(), r)
+		return err
+	}
+	if err := decode(`{"a":1}`, 100); err != nil {
+		t.Fatal(err)
+	}
+	var maxBytesErr *http.MaxBytesError
+	if err := decode(`{"a":"0123456789"}`, 10); !errors.As(err, &maxBytesErr) || maxBytesErr.Limit != 10 {
+		t.Fatal(err)
+	}
+}
+
+func TestGearDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var done = make(chan bool)
+	go gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-gear.G(r).Done():
+			done <- true
+		case <-time.After(time.Second):
+			done <- false
+		}
+	}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	cancel()
+	if !<-done {
+		t.Fatal("not done")
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	var tests = []struct {
+		method   string
+		header   string
+		form     string
+		want     string
+		original string
+	}{
+		{http.MethodPost, "delete", "", http.MethodDelete, http.MethodPost},
+		{http.MethodPost, "", "_method=PUT", http.MethodPut, http.MethodPost},
+		{http.MethodPost, "", "_method=CONNECT", http.MethodPost, http.MethodPost},
+		{http.MethodGet, "DELETE", "", http.MethodGet, http.MethodGet},
+	}
+	for _, test := range tests {
+		var method, original string
+		r := httptest.NewRequest(test.method, "/", strings.NewReader(test.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if test.header != "" {
+			r.Header.Set(gear.MethodOverrideHeader, test.header)
+		}
+		gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, original = r.Method, gear.G(r).OriginalMethod()
+		}, gear.MethodOverride()).ServeHTTP(httptest.NewRecorder(), r)
+		if method != test.want || original != test.original {
+			t.Fatal(test, method, original)
+		}
+	}
+}
+
+func TestReplayHeaders(t *testing.T) {
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "a", Value: "1"})
+		http.SetCookie(w, &http.Cookie{Name: "b", Value: "2"})
+		w.Header().Set("X-Single", "v")
+	}, gear.MiddlewareFuncWitName(func(g *gear.Gear, next func(*gear.Gear)) {
+		var w = g.W
+		var buf = httptest.NewRecorder()
+		g.W = buf
+		next(g)
+		g.ReplayHeaders(w)
+		g.W = w
+		w.WriteHeader(buf.Code)
+	}, "Buffer"))
+	w := httptest.NewRecorder()
+	w.Header().Add("Set-Cookie", "old=0")
+	w.Header().Set("X-Other", "o")
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if cookies := w.Header().Values("Set-Cookie"); !slices.Equal(cookies, []string{"a=1", "b=2"}) ||
+		w.Header().Get("X-Single") != "v" || w.Header().Get("X-Other") != "o" {
+		t.Fatal(w.Header())
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	var tests = []struct {
+		filename    string
+		contentType string
+		wantCD      string
+		wantCT      string
+	}{
+		{"report.csv", "", `attachment; filename="report.csv"`, "text/csv; charset=utf-8"},
+		{`a"b.bin`, "application/x-custom", `attachment; filename="a\"b.bin"`, "application/x-custom"},
+		{"数据 1.unknownext", "", `attachment; filename="______ 1.unknownext"; filename*=UTF-8''%E6%95%B0%E6%8D%AE%201.unknownext`, "application/octet-stream"},
+	}
+	for _, test := range tests {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := gear.G(r).Attachment(strings.NewReader("data"), test.filename, test.contentType); err != nil {
+				t.Fatal(err)
+			}
+		})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if cd := w.Header().Get("Content-Disposition"); cd != test.wantCD {
+			t.Fatal(cd)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != test.wantCT {
+			t.Fatal(ct)
+		}
+		if w.Body.String() != "data" {
+			t.Fatal(w.Body.String())
+		}
+		if _, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition")); err != nil || params["filename"] != test.filename {
+			t.Fatal(params, err)
+		}
+	}
+}
+
+func TestNewTestGear(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		n, err := gear.Query[int](g, "n")
+		if err != nil {
+			g.Code(http.StatusBadRequest)
+			return
+		}
+		g.JSONResponse(http.StatusOK, n+1)
+	}
+	w := httptest.NewRecorder()
+	g := gear.NewTestGear(w, httptest.NewRequest(http.MethodGet, "/?n=1", nil))
+	if gear.G(g.R) != g {
+		t.Fatal()
+	}
+	handler(g.W, g.R)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "2" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+}
+
+func TestPathInt(t *testing.T) {
+	var tests = []struct {
+		id   string
+		want int
+		code int
+	}{
+		{"12", 12, http.StatusOK},
+		{"x", 0, http.StatusBadRequest},
+		{"", 0, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetPathValue("id", test.id)
+		g := gear.NewTestGear(w, r)
+		id, err := g.MustPathInt("id")
+		if id != test.want || w.Code != test.code {
+			t.Fatal(test, id, err, w.Code)
+		}
+		var missing gear.MissingPathValueError
+		if test.id == "" && (!errors.As(err, &missing) || missing != "id") {
+			t.Fatal(err)
+		}
+	}
+}
+
+// brokenPipeWriter is a http.ResponseWriter whose Write always fails with EPIPE.
+type brokenPipeWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w brokenPipeWriter) Write(p []byte) (int, error) {
+	return 0, &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+}
+
+func (w brokenPipeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func TestErrClientGone(t *testing.T) {
+	g := gear.NewTestGear(brokenPipeWriter{httptest.NewRecorder()}, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, err := range []error{
+		g.String("a"),
+		g.JSONResponse(http.StatusOK, 1),
+		g.Write(strings.NewReader("a")),
+		g.Problem(http.StatusNotFound, gear.Problem{}),
+		func() error { _, err := g.JSONStream(); return err }(),
+	} {
+		if !errors.Is(err, gear.ErrClientGone) || !errors.Is(err, syscall.EPIPE) {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&buf, nil)), func() {
+		gear.LogIfErr(g.String("a"))
+	})
+	if buf.Len() != 0 { // Logged at LevelDebug.
+		t.Fatal(buf.String())
+	}
+}
+
+func TestHeaderParams(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-RateLimit-Remaining", "42")
+	r.Header.Set("X-Bad", "x")
+	r.Header.Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	r.Header.Add("X-Ids", "1")
+	r.Header.Add("X-Ids", "2")
+	g := gear.NewTestGear(httptest.NewRecorder(), r)
+
+	if n, ok := g.HeaderInt("x-ratelimit-remaining"); !ok || n != 42 {
+		t.Fatal(n, ok)
+	}
+	if _, ok := g.HeaderInt("X-Bad"); ok {
+		t.Fatal()
+	}
+	if _, ok := g.HeaderInt("X-Absent"); ok {
+		t.Fatal()
+	}
+	if tm, ok := g.HeaderTime("Last-Modified"); !ok || !tm.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatal(tm, ok)
+	}
+	if ids, err := gear.Header[[]int](g, "X-Ids"); err != nil || !slices.Equal(ids, []int{1, 2}) {
+		t.Fatal(ids, err)
+	}
+	if date, err := gear.Header[encoding.HTTPDate](g, "Last-Modified"); err != nil || time.Time(date).Year() != 2006 {
+		t.Fatal(date, err)
+	}
+	var fieldErr *encoding.DecodeFieldError
+	if _, err := gear.Header[int](g, "X-Bad"); !errors.As(err, &fieldErr) || fieldErr.Name != "X-Bad" {
+		t.Fatal(err)
+	}
+}
+
+func TestWrapWithNotFound(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).StringResponse(http.StatusNotFound, "no such user")
+	})
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", encoding.MIME_JSON)
+		gear.G(r).JSONResponse(http.StatusNotFound, map[string]string{"error": "not found", "path": r.URL.Path})
+	})
+	client := geartest.NewClient(gear.WrapWithNotFound(&mux, notFound))
+
+	var tests = []struct {
+		path string
+		code int
+		ct   string
+		body string
+	}{
+		{"/ok", http.StatusOK, "text/plain; charset=utf-8", "ok"},
+		{"/user", http.StatusNotFound, "", "no such user"},
+		{"/missing", http.StatusNotFound, encoding.MIME_JSON, `{"error":"not found","path":"/missing"}` + "\n"},
+	}
+	for _, test := range tests {
+		resp := client.Get(test.path)
+		if resp.StatusCode != test.code || resp.Header.Get("Content-Type") != test.ct || string(resp.Body) != test.body {
+			t.Fatal(test, resp.StatusCode, resp.Header, string(resp.Body))
+		}
+		if test.ct == encoding.MIME_JSON && resp.Header.Get("X-Content-Type-Options") != "" {
+			t.Fatal(resp.Header)
+		}
+	}
+}
+
+func TestSetTrailer(t *testing.T) {
+	var count atomic.Int32
+	server := gear.NewTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		g.SetTrailer("x-status", "pending")
+		g.String("body")
+		g.SetTrailer("X-Status", fmt.Sprint("done ", count.Add(1)))
+	}), gear.Idempotency(gear.NewMemoryIdempotencyStore(time.Minute)))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		r := gg.Must(http.NewRequest(http.MethodPost, server.URL, nil))
+		r.Header.Set("Idempotency-Key", "k1")
+		resp := gg.Must(http.DefaultClient.Do(r))
+		body := gg.Must(io.ReadAll(resp.Body))
+		resp.Body.Close()
+		if string(body) != "body" {
+			t.Fatal(string(body))
+		}
+		if trailer := resp.Trailer.Get("X-Status"); trailer != "done 1" {
+			t.Fatal(i, trailer, resp.Trailer)
+		}
+		if resp.Header.Get("X-Status") != "" {
+			t.Fatal(resp.Header)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	w := httptest.NewRecorder()
+	g := gear.NewTestGear(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	g.CacheControl(90*time.Second+500*time.Millisecond, true)
+	if cc := w.Header().Get("Cache-Control"); cc != "public, max-age=90" {
+		t.Fatal(cc)
+	}
+	expires, err := http.ParseTime(w.Header().Get("Expires"))
+	if err != nil || time.Until(expires) < 85*time.Second || time.Until(expires) > 91*time.Second {
+		t.Fatal(expires, err)
+	}
+	g.CacheControl(-time.Second, false)
+	if cc := w.Header().Get("Cache-Control"); cc != "private, max-age=0" {
+		t.Fatal(cc)
+	}
+	g.NoStore()
+	if cc := w.Header().Get("Cache-Control"); cc != "no-store" || w.Header().Get("Expires") != "" {
+		t.Fatal(w.Header())
+	}
+}
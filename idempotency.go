@@ -0,0 +1,172 @@
+package gear
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header used by [Idempotency].
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyReplayedHeader is the response header set to "true" by [Idempotency]
+// when the response is replayed.
+const IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+// IdempotentResponse is a response stored by [Idempotency].
+type IdempotentResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IdempotencyStore stores the responses for [Idempotency].
+// An IdempotencyStore must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Get returns the response stored with key, or nil if there is no such response
+	// or it has expired.
+	Get(key string) (*IdempotentResponse, error)
+	// Set stores resp with key.
+	// The implementation decides how long resp lives before it expires.
+	Set(key string, resp *IdempotentResponse) error
+}
+
+// idempotencyStoreKey returns the key in [IdempotencyStore] of request r with Idempotency-Key header key.
+// The key is scoped by the method, the path and the SHA-256 hash of the body of r,
+// so a key reused for a different request does not replay a wrong response.
+// The body of r is read and restored.
+func idempotencyStoreKey(r *http.Request, key string) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return fmt.Sprintf("%s %q %x %q", r.Method, r.URL.Path, sha256.Sum256(body), key), nil
+}
+
+// Idempotency returns a [Middleware] which makes requests with an Idempotency-Key header retry-safe.
+// The response of the first request with a key is stored in store, and the repeated requests
+// with the same key, method, path and body get the stored response replayed, with Idempotent-Replayed header
+// set to "true", instead of re-running the handler. The body is read into memory to be compared.
+// The responses of server errors, status codes 5xx, are not stored, so the retries re-run the handler.
+// A request arrives while another one with the same key is still in flight gets a http.StatusConflict response.
+// Note that the in-flight requests are tracked in this process only.
+// If the body can't be read, a http.StatusBadRequest response is written.
+// If store errors out getting the response, a http.StatusInternalServerError response is written.
+// Requests without an Idempotency-Key header are unaffected.
+func Idempotency(store IdempotencyStore) Middleware {
+	var mu sync.Mutex
+	var inFlight = make(map[string]bool)
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var key = g.R.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(g)
+			return
+		}
+		key, err := idempotencyStoreKey(g.R, key)
+		if err != nil {
+			g.Code(http.StatusBadRequest)
+			g.Stop()
+			return
+		}
+		mu.Lock()
+		if inFlight[key] {
+			mu.Unlock()
+			g.Code(http.StatusConflict)
+			g.Stop()
+			return
+		}
+		inFlight[key] = true
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			delete(inFlight, key)
+			mu.Unlock()
+		}()
+
+		resp, err := store.Get(key)
+		if LogIfErr(err) != nil {
+			g.Code(http.StatusInternalServerError)
+			g.Stop()
+			return
+		}
+		if resp != nil {
+			var header = g.W.Header()
+			copyHeader(header, resp.Header)
+			header.Set(IdempotencyReplayedHeader, "true")
+			g.W.WriteHeader(resp.StatusCode)
+			LogIfErrT(g.W.Write(resp.Body))
+			g.Stop()
+			return
+		}
+
+		var w = g.W
+		var cw = newCaptureWriter(w, -1)
+		g.W = cw
+		defer func() { g.W = w }()
+		next(g)
+		if cw.status() >= http.StatusInternalServerError {
+			return
+		}
+		LogIfErr(store.Set(key, &IdempotentResponse{
+			StatusCode: cw.status(),
+			Header:     cw.headers(),
+			Body:       cw.body.Bytes(),
+		}))
+	}, "Idempotency")
+}
+
+// memoryIdempotencyEntry is an entry of memoryIdempotencyStore.
+type memoryIdempotencyEntry struct {
+	resp    *IdempotentResponse
+	expires time.Time
+}
+
+// memoryIdempotencyStore is an in-memory [IdempotencyStore].
+type memoryIdempotencyStore struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]memoryIdempotencyEntry
+}
+
+// NewMemoryIdempotencyStore returns an in-memory [IdempotencyStore].
+// Responses stored expire after ttl.
+func NewMemoryIdempotencyStore(ttl time.Duration) IdempotencyStore {
+	return &memoryIdempotencyStore{ttl: ttl, entries: make(map[string]memoryIdempotencyEntry)}
+}
+
+// Get implements [IdempotencyStore].
+func (s *memoryIdempotencyStore) Get(key string) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+	return entry.resp, nil
+}
+
+// Set implements [IdempotencyStore].
+func (s *memoryIdempotencyStore) Set(key string, resp *IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var now = time.Now()
+	for k, entry := range s.entries { // Remove expired entries.
+		if now.After(entry.expires) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memoryIdempotencyEntry{resp, now.Add(s.ttl)}
+	return nil
+}
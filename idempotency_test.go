@@ -0,0 +1,74 @@
+package gear_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gear/internal/geartest"
+)
+
+func TestIdempotency(t *testing.T) {
+	var count atomic.Int32
+	var entered = make(chan struct{})
+	var release = make(chan struct{})
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		n := count.Add(1)
+		w.Header().Set("X-Count", fmt.Sprint(n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "count %v", n)
+	})
+	var failures atomic.Int32
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, fmt.Sprint("failure ", failures.Add(1)), http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	server := gear.NewTestServer(&mux, gear.Idempotency(gear.NewMemoryIdempotencyStore(time.Minute)))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		body, vars := geartest.Curl(server.URL, "-X", "POST", "-H", "Idempotency-Key: k1")
+		if string(body) != "count 1" || vars["response_code"] != float64(http.StatusCreated) {
+			t.Fatal(string(body), vars["response_code"])
+		}
+	}
+	// Same key with a different body or path.
+	if body, _ := geartest.CurlPOST(server.URL, "text/plain", "data", "-H", "Idempotency-Key: k1"); string(body) != "count 2" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL+"/other", "-X", "POST", "-H", "Idempotency-Key: k1"); string(body) != "count 3" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL, "-X", "POST", "-H", "Idempotency-Key: k2"); string(body) != "count 4" {
+		t.Fatal(string(body))
+	}
+	if body, _ := geartest.Curl(server.URL, "-X", "POST"); string(body) != "count 5" {
+		t.Fatal(string(body))
+	}
+	// Server errors are not stored.
+	for i := 1; i <= 2; i++ {
+		body, vars := geartest.Curl(server.URL+"/fail", "-X", "POST", "-H", "Idempotency-Key: k4")
+		if string(body) != fmt.Sprintf("failure %v\n", i) || vars["response_code"] != float64(http.StatusServiceUnavailable) {
+			t.Fatal(string(body), vars["response_code"])
+		}
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		geartest.Curl(server.URL+"/slow", "-X", "POST", "-H", "Idempotency-Key: k3")
+	}()
+	<-entered
+	if _, vars := geartest.Curl(server.URL+"/slow", "-X", "POST", "-H", "Idempotency-Key: k3"); vars["response_code"] != float64(http.StatusConflict) {
+		t.Fatal(vars["response_code"])
+	}
+	close(release)
+	<-done
+}
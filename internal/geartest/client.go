@@ -0,0 +1,74 @@
+package geartest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// Response is the response received by [Client].
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Client sends requests to a handler in-process, without a server or the curl executable.
+// It is faster than [Curl] and preferred unless a real HTTP connection is needed.
+type Client struct {
+	Handler http.Handler
+}
+
+// NewClient returns a Client sending requests to handler.
+func NewClient(handler http.Handler) *Client {
+	return &Client{Handler: handler}
+}
+
+// Get sends a GET request to url.
+func (c *Client) Get(url string) *Response {
+	return c.Request(http.MethodGet, url).Do()
+}
+
+// Post sends a POST request to url with body of contentType.
+func (c *Client) Post(url string, contentType string, body string) *Response {
+	return c.Request(http.MethodPost, url).Body(contentType, body).Do()
+}
+
+// Request returns a RequestBuilder building a request of method to url.
+func (c *Client) Request(method string, url string) *RequestBuilder {
+	return &RequestBuilder{client: c, method: method, url: url, header: make(http.Header)}
+}
+
+// RequestBuilder builds a request sent by [Client].
+type RequestBuilder struct {
+	client *Client
+	method string
+	url    string
+	header http.Header
+	body   io.Reader
+}
+
+// Header adds a header entry to the request.
+func (b *RequestBuilder) Header(key, value string) *RequestBuilder {
+	b.header.Add(key, value)
+	return b
+}
+
+// Body sets the body of the request, and the Content-Type header to contentType.
+func (b *RequestBuilder) Body(contentType string, body string) *RequestBuilder {
+	b.header.Set("Content-Type", contentType)
+	b.body = strings.NewReader(body)
+	return b
+}
+
+// Do sends the request and returns the response.
+func (b *RequestBuilder) Do() *Response {
+	r := httptest.NewRequest(b.method, b.url, b.body)
+	for key, values := range b.header {
+		r.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	b.client.Handler.ServeHTTP(w, r)
+	return &Response{StatusCode: w.Code, Header: w.Header(), Body: w.Body.Bytes()}
+}
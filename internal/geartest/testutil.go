@@ -16,6 +16,7 @@ var responseRegexp = regexp.MustCompile(`(?s)(.*)\n(.+)`)
 // respBody is the response body returned.
 // vars are the json format of all curl write-out variables.
 // See https://everything.curl.dev/usingcurl/verbose/writeout.html
+// Curl requires the curl executable and a running server, use [Client] unless it is an integration test.
 func Curl(url string, params ...string) (respBody []byte, vars map[string]any) {
 	cmd := exec.Command("curl", append(params, []string{
 		"-w", "\n%{json}",
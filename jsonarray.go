@@ -0,0 +1,82 @@
+package gear
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/mkch/gear/encoding"
+)
+
+// jsonArrayFlushInterval is the number of elements written by [JSONArrayWriter] between flushes.
+const jsonArrayFlushInterval = 64
+
+// ErrJSONArrayClosed is returned by [JSONArrayWriter] methods after it is closed.
+var ErrJSONArrayClosed = errors.New("gear: JSON array writer closed")
+
+// JSONArrayWriter writes a JSON array to the response element by element.
+// Use [Gear.JSONStream] to create one.
+type JSONArrayWriter struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	buf    bytes.Buffer
+	n      int  // Number of elements written.
+	closed bool // Whether Close has been called.
+}
+
+// JSONStream sets Content-Type of the response to JSON, writes the beginning of a JSON array
+// and returns a [JSONArrayWriter] to write the elements. The caller must call Close of the writer
+// to end the array. The response is flushed periodically if supported.
+// It is suitable for streaming a large number of elements without building a giant slice first.
+func (g *Gear) JSONStream() (*JSONArrayWriter, error) {
+	g.W.Header().Set("Content-Type", encoding.MIME_JSON)
+	if _, err := io.WriteString(g.W, "["); err != nil {
+		return nil, clientGone(err)
+	}
+	return &JSONArrayWriter{w: g.W, rc: http.NewResponseController(g.W)}, nil
+}
+
+// Write writes the JSON encoding of v as the next element of the array.
+// v is encoded into a buffer first, and nothing is written if the encoding fails.
+func (w *JSONArrayWriter) Write(v any) error {
+	if w.closed {
+		return ErrJSONArrayClosed
+	}
+	w.buf.Reset()
+	if w.n > 0 {
+		w.buf.WriteByte(',')
+	}
+	if err := encoding.EncodeJSON(v, &w.buf); err != nil {
+		return err
+	}
+	w.buf.Truncate(len(bytes.TrimRight(w.buf.Bytes(), "\n")))
+	if _, err := w.buf.WriteTo(w.w); err != nil {
+		return clientGone(err)
+	}
+	w.n++
+	if w.n%jsonArrayFlushInterval == 0 {
+		w.flush()
+	}
+	return nil
+}
+
+// Close writes the end of the array and flushes the response.
+func (w *JSONArrayWriter) Close() error {
+	if w.closed {
+		return ErrJSONArrayClosed
+	}
+	w.closed = true
+	if _, err := io.WriteString(w.w, "]\n"); err != nil {
+		return clientGone(err)
+	}
+	w.flush()
+	return nil
+}
+
+// flush flushes the response if supported.
+func (w *JSONArrayWriter) flush() {
+	if err := w.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		LogIfErr(err)
+	}
+}
@@ -0,0 +1,51 @@
+package gear
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// JSONSchemaValidator validates JSON documents against a compiled JSON Schema.
+type JSONSchemaValidator interface {
+	// Validate validates the JSON document doc.
+	// If the validation failed, Validate returns an non-nil error describing the reason.
+	Validate(doc []byte) error
+}
+
+// ErrNoJSONSchemaCompiler is returned by [CompileJSONSchema] if no JSON Schema implementation is provided.
+var ErrNoJSONSchemaCompiler = errors.New("gear: no JSON Schema compiler, see gear.CompileJSONSchema")
+
+// CompileJSONSchema compiles the JSON Schema document schema into a [JSONSchemaValidator].
+// This package does not depend on any JSON Schema implementation, CompileJSONSchema returns
+// [ErrNoJSONSchemaCompiler] until it is replaced, typically with an adapter of a schema library.
+var CompileJSONSchema = func(schema string) (JSONSchemaValidator, error) {
+	return nil, ErrNoJSONSchemaCompiler
+}
+
+// JSONSchema returns a [Middleware] which validates the request body against the JSON Schema
+// document schema, compiled by [CompileJSONSchema].
+// The body is read and restored for the downstream middlewares and handler.
+// If the validation fails, a http.StatusBadRequest response with the error message is written,
+// and the middleware processing is stopped.
+// A non-nil error is returned if schema can't be compiled.
+func JSONSchema(schema string) (Middleware, error) {
+	validator, err := CompileJSONSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		body, err := io.ReadAll(g.R.Body)
+		if err == nil {
+			g.R.Body = io.NopCloser(bytes.NewReader(body))
+			err = validator.Validate(body)
+		}
+		if err != nil {
+			LogIfErr(g.StringResponse(http.StatusBadRequest, err.Error()))
+			g.Stop()
+			return
+		}
+		next(g)
+	}, "JSONSchema"), nil
+}
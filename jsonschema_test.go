@@ -0,0 +1,66 @@
+package gear_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+// requiredKeysValidator is a toy JSON Schema validator supporting only "required".
+type requiredKeysValidator []string
+
+func (v requiredKeysValidator) Validate(doc []byte) error {
+	var obj map[string]any
+	if err := json.Unmarshal(doc, &obj); err != nil {
+		return err
+	}
+	for _, key := range v {
+		if _, ok := obj[key]; !ok {
+			return errors.New("missing " + key)
+		}
+	}
+	return nil
+}
+
+func TestJSONSchema(t *testing.T) {
+	if _, err := gear.JSONSchema(`{}`); err != gear.ErrNoJSONSchemaCompiler {
+		t.Fatal(err)
+	}
+	old := gear.CompileJSONSchema
+	defer func() { gear.CompileJSONSchema = old }()
+	gear.CompileJSONSchema = func(schema string) (gear.JSONSchemaValidator, error) {
+		var s struct{ Required []string }
+		if err := json.Unmarshal([]byte(schema), &s); err != nil {
+			return nil, err
+		}
+		return requiredKeysValidator(s.Required), nil
+	}
+
+	mw, err := gear.JSONSchema(`{"required":["id"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}, mw)
+	for _, test := range []struct {
+		body string
+		code int
+		want string
+	}{
+		{`{"id":1}`, http.StatusOK, `{"id":1}`},
+		{`{"name":"a"}`, http.StatusBadRequest, "missing id"},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+		if w.Code != test.code || w.Body.String() != test.want {
+			t.Fatal(w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/mkch/gear/locale
+
+go 1.22.5
+
+require (
+	github.com/mkch/gear v0.0.0-00010101000000-000000000000
+	golang.org/x/text v0.18.0
+)
+
+require github.com/mkch/gg v0.0.0-20240802180114-a8ab4d0b45a6 // indirect
+
+replace github.com/mkch/gear => ../
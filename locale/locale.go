@@ -0,0 +1,90 @@
+/*
+Package locale implements a [gear.Middleware] negotiating the locale of the request.
+It is a separate module, so the core module does not depend on golang.org/x/text.
+*/
+package locale
+
+import (
+	"errors"
+
+	"github.com/mkch/gear"
+	"golang.org/x/text/language"
+)
+
+type contextKey string
+
+// ctxKey is the context key of the negotiated locale in http.Request.Context().
+const ctxKey contextKey = "locale"
+
+// Options are options for [Middleware]. A zero Options consists entirely of zero values.
+type Options struct {
+	// QueryKey is the key of URL query to override the locale, e.g. "lang".
+	// Zero value means the locale can't be overridden by URL query.
+	QueryKey string
+	// CookieName is the name of cookie to override the locale.
+	// Zero value means the locale can't be overridden by cookie.
+	CookieName string
+}
+
+// Middleware returns a [gear.Middleware] which negotiates the best locale in supported
+// for the request and stores it in the request context. Use [Get] to retrieve it.
+// If opt is nil, the default options are used.
+//
+// The locale is negotiated by the Accept-Language header, but it can be overridden
+// by URL query or cookie(see [Options]), in that order of precedence.
+// Only locales in supported can be negotiated. The first element of supported is the default locale.
+// Middleware panics if supported is empty.
+func Middleware(supported []language.Tag, opt *Options) gear.Middleware {
+	if len(supported) == 0 {
+		panic(errors.New("gear: no supported locale"))
+	}
+	supported = append([]language.Tag(nil), supported...)
+	var matcher = language.NewMatcher(supported)
+	// match returns the best supported tag or false if no tag in desired is valid.
+	var match = func(desired ...string) (language.Tag, bool) {
+		var tags []language.Tag
+		for _, s := range desired {
+			if tag, err := language.Parse(s); err == nil {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			return language.Und, false
+		}
+		_, index, _ := matcher.Match(tags...)
+		return supported[index], true
+	}
+	return gear.MiddlewareFuncWitName(func(g *gear.Gear, next func(*gear.Gear)) {
+		var tag, ok = language.Und, false
+		if opt != nil && opt.QueryKey != "" {
+			if value := g.R.URL.Query().Get(opt.QueryKey); value != "" {
+				tag, ok = match(value)
+			}
+		}
+		if !ok && opt != nil && opt.CookieName != "" {
+			if cookie, err := g.R.Cookie(opt.CookieName); err == nil {
+				tag, ok = match(cookie.Value)
+			}
+		}
+		if !ok {
+			if desired, _, err := language.ParseAcceptLanguage(g.R.Header.Get("Accept-Language")); err == nil && len(desired) > 0 {
+				_, index, _ := matcher.Match(desired...)
+				tag, ok = supported[index], true
+			}
+		}
+		if !ok {
+			tag = supported[0]
+		}
+		g.SetContextValue(ctxKey, tag)
+		next(g)
+	}, "Locale")
+}
+
+// Get returns the locale of the request of g negotiated by [Middleware],
+// or [language.Und] if the middleware is not used.
+func Get(g *gear.Gear) language.Tag {
+	if tag, ok := g.ContextValue(ctxKey).(language.Tag); ok {
+		return tag
+	}
+	return language.Und
+}
@@ -0,0 +1,65 @@
+package locale_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gear/internal/geartest"
+	"github.com/mkch/gear/locale"
+	"golang.org/x/text/language"
+)
+
+func TestLocale(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, locale.Get(gear.G(r)))
+	})
+	client := geartest.NewClient(gear.Wrap(&mux, locale.Middleware(
+		[]language.Tag{language.English, language.SimplifiedChinese, language.French},
+		&locale.Options{QueryKey: "lang", CookieName: "lang"})))
+
+	var tests = []struct {
+		url            string
+		acceptLanguage string
+		cookie         string
+		want           string
+	}{
+		{"/", "", "", "en"},
+		{"/", "fr-CH, fr;q=0.9, en;q=0.8", "", "fr"},
+		{"/", "zh-CN", "", "zh-Hans"},
+		{"/", "de", "", "en"},
+		{"/?lang=fr", "zh-CN", "lang=zh", "fr"},
+		{"/?lang=!", "zh-CN", "lang=fr", "fr"},
+	}
+	for _, test := range tests {
+		req := client.Request(http.MethodGet, test.url)
+		if test.acceptLanguage != "" {
+			req.Header("Accept-Language", test.acceptLanguage)
+		}
+		if test.cookie != "" {
+			req.Header("Cookie", test.cookie)
+		}
+		if body := req.Do().Body; string(body) != test.want {
+			t.Fatal(test, string(body))
+		}
+	}
+
+	var tag language.Tag
+	geartest.NewClient(gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag = locale.Get(gear.G(r))
+	})).Get("/")
+	if tag != language.Und {
+		t.Fatal(tag)
+	}
+}
+
+func TestLocalePanic(t *testing.T) {
+	defer func() {
+		if err, ok := recover().(error); !ok || err.Error() != "gear: no supported locale" {
+			t.Fatal(err)
+		}
+	}()
+	locale.Middleware(nil, nil)
+}
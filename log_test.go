@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/mkch/gear"
+	"github.com/mkch/gear/encoding"
 	runtimegg "github.com/mkch/gg/runtime"
 )
 
@@ -91,3 +96,185 @@ func TestLog(t *testing.T) {
 		}
 	})
 }
+
+func TestDebugChain(t *testing.T) {
+	var buf bytes.Buffer
+	gear.DebugChain = true
+	defer func() { gear.DebugChain = false }()
+	withLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				a = slog.Attr{}
+			}
+			return a
+		},
+	})), func() {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {},
+			gear.MiddlewareFuncWitName(func(g *gear.Gear, next func(*gear.Gear)) {
+				g.Stop()
+			}, "stopper"),
+			gear.MiddlewareFunc(func(g *gear.Gear, next func(*gear.Gear)) {
+				next(g)
+			}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+	expected := `level=DEBUG msg="enter middleware" name=gear.MiddlewareFunc
+level=DEBUG msg="enter middleware" name=stopper
+level=DEBUG msg="exit middleware" name=stopper stopped=true
+level=DEBUG msg="exit middleware" name=gear.MiddlewareFunc stopped=true
+`
+	if buf.String() != expected {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestPanicRecoveryWithOptions(t *testing.T) {
+	var w bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&w, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "time" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})), func() {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oops")
+		}, gear.PanicRecoveryWithOptions(&gear.PanicRecoveryOptions{
+			Level:      slog.LevelWarn,
+			Message:    "panic",
+			AddRequest: true,
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/a?b=1", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatal(rec.Code)
+		}
+
+		// nil options are the same as PanicRecovery(false).
+		handler = gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oops")
+		}, gear.PanicRecoveryWithOptions(nil))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/c", nil))
+	})
+	if output := w.String(); output != `level=WARN msg=panic value=oops method=POST URL="/a?b=1"`+"\n"+
+		`level=ERROR msg="recovered from panic" value=oops method=GET URL=/c`+"\n" {
+		t.Fatal(output)
+	}
+}
+
+func TestPanicRecoveryRender(t *testing.T) {
+	withLogger(slog.New(slog.NewTextHandler(io.Discard, nil)), func() {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("oops")
+		}, gear.PanicRecoveryWithOptions(&gear.PanicRecoveryOptions{
+			Render: func(g *gear.Gear, v any) {
+				g.W.Header().Set("Content-Type", encoding.MIME_JSON)
+				g.JSONResponse(http.StatusInternalServerError, map[string]any{"error": v})
+			},
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusInternalServerError ||
+			rec.Header().Get("Content-Type") != encoding.MIME_JSON ||
+			strings.TrimSpace(rec.Body.String()) != `{"error":"oops"}` {
+			t.Fatal(rec.Code, rec.Header(), rec.Body.String())
+		}
+	})
+}
+
+func TestGearLogValue(t *testing.T) {
+	var w bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "time" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/a?b=1", nil)
+	r.Header.Set(gear.RequestIDHeader, "abc")
+	g := gear.NewTestGear(httptest.NewRecorder(), r)
+	logger.Info("handling", "req", g)
+	if output := w.String(); output != "level=INFO msg=handling req.method=GET req.path=/a req.remote=192.0.2.1:1234 req.request_id=abc\n" {
+		t.Fatal(output)
+	}
+}
+
+func TestRequestIDCorrelation(t *testing.T) {
+	var w bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "time" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	withLogger(logger, func() {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+			gear.RawLogger.Info("handling", "req", gear.G(r))
+			panic("oops")
+		},
+			gear.Logger(&gear.LoggerOptions{Keys: map[string]bool{gear.LoggerMethodKey: true, gear.LoggerRequestIDKey: true}}),
+			gear.RequestID(),
+			gear.PanicRecoveryWithOptions(&gear.PanicRecoveryOptions{}))
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/a", nil)
+		r.Header.Set(gear.RequestIDHeader, "abc")
+		handler.ServeHTTP(rec, r)
+		if id := rec.Header().Get(gear.RequestIDHeader); id != "abc" {
+			t.Fatal(id)
+		}
+		if output := w.String(); output != "level=INFO msg=HTTP method=GET request_id=abc\n"+
+			"level=INFO msg=handling req.method=GET req.path=/a req.remote=192.0.2.1:1234 req.request_id=abc\n"+
+			"level=ERROR msg=\"recovered from panic\" value=oops request_id=abc\n" {
+			t.Fatal(output)
+		}
+
+		// Invalid IDs are replaced.
+		rec = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/a", nil)
+		r.Header.Set(gear.RequestIDHeader, "a b")
+		handler.ServeHTTP(rec, r)
+		if id := rec.Header().Get(gear.RequestIDHeader); len(id) != 32 {
+			t.Fatal(id)
+		}
+	})
+}
+
+func TestGearLogger(t *testing.T) {
+	var w bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == "time" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/orders?x=1", nil)
+	r.Header.Set(gear.RequestIDHeader, "abc")
+	g := gear.NewTestGear(httptest.NewRecorder(), r)
+	withLogger(logger, func() {
+		g.Logger().Info("processed order", "id", 1)
+		if g.Logger() != g.Logger() {
+			t.Fatal("not cached")
+		}
+	})
+	if output := w.String(); output != "level=INFO msg=\"processed order\" request_id=abc method=POST path=/orders id=1\n" {
+		t.Fatal(output)
+	}
+
+	// Created again if RawLogger is replaced.
+	var w2 bytes.Buffer
+	withLogger(slog.New(slog.NewTextHandler(&w2, nil)), func() {
+		g.Logger().Info("again")
+	})
+	if !strings.Contains(w2.String(), "msg=again request_id=abc") {
+		t.Fatal(w2.String())
+	}
+}
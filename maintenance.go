@@ -0,0 +1,68 @@
+package gear
+
+import (
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MaintenanceOptions are options for [Maintenance]. A zero MaintenanceOptions consists entirely of zero values.
+type MaintenanceOptions struct {
+	// Body is the response body sent in maintenance mode.
+	// Zero value means the status text of http.StatusServiceUnavailable.
+	Body string
+	// RetryAfter is the value of Retry-After header, rounded up to seconds.
+	// Zero value means no Retry-After header.
+	RetryAfter time.Duration
+	// AllowPaths are the URL paths served normally in maintenance mode, health checks for example.
+	// Zero value means no path is allowed.
+	AllowPaths []string
+	// AllowIPs are the client IP ranges served normally in maintenance mode.
+	// Zero value means no IP is allowed.
+	AllowIPs []netip.Prefix
+	// ClientIP are the options used to get the client IP, see [Gear.ClientIP].
+	// Zero value means the host part of the remote address is used.
+	ClientIP *ClientIPOptions
+}
+
+// Maintenance returns a [Middleware] which puts the server into maintenance mode when enabled is set.
+// In maintenance mode, requests get a http.StatusServiceUnavailable response, and the middleware
+// processing is stopped, except those allowed by opt.
+// If opt is nil, the default options are used.
+func Maintenance(enabled *atomic.Bool, opt *MaintenanceOptions) Middleware {
+	if opt == nil {
+		opt = &MaintenanceOptions{}
+	}
+	var retryAfter string
+	if opt.RetryAfter > 0 {
+		retryAfter = strconv.FormatInt(int64((opt.RetryAfter+time.Second-1)/time.Second), 10)
+	}
+	var allowPaths = slices.Clone(opt.AllowPaths)
+	var allowIPs = slices.Clone(opt.AllowIPs)
+	var body = opt.Body
+	var clientIP = opt.ClientIP
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		if !enabled.Load() || slices.Contains(allowPaths, g.R.URL.Path) {
+			next(g)
+			return
+		}
+		if len(allowIPs) > 0 {
+			if addr, err := netip.ParseAddr(g.ClientIP(clientIP)); err == nil && prefixesContain(allowIPs, addr.Unmap()) {
+				next(g)
+				return
+			}
+		}
+		if retryAfter != "" {
+			g.W.Header().Set("Retry-After", retryAfter)
+		}
+		if body == "" {
+			g.Code(http.StatusServiceUnavailable)
+		} else {
+			LogIfErr(g.StringResponse(http.StatusServiceUnavailable, body))
+		}
+		g.Stop()
+	}, "Maintenance")
+}
@@ -0,0 +1,54 @@
+package gear_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkch/gear"
+)
+
+func TestMaintenance(t *testing.T) {
+	var enabled atomic.Bool
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).String("ok")
+	}, gear.Maintenance(&enabled, &gear.MaintenanceOptions{
+		Body:       "maintenance",
+		RetryAfter: time.Minute,
+		AllowPaths: []string{"/health"},
+		AllowIPs:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+	}))
+	serve := func(path, remote string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve("/", "192.0.2.1:1"); w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatal(w.Code, w.Body.String())
+	}
+	enabled.Store(true)
+	if w := serve("/", "192.0.2.1:1"); w.Code != http.StatusServiceUnavailable || w.Body.String() != "maintenance" || w.Header().Get("Retry-After") != "60" {
+		t.Fatal(w.Code, w.Body.String(), w.Header())
+	}
+	if w := serve("/health", "192.0.2.1:1"); w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	if w := serve("/", "10.1.2.3:1"); w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+
+	// Rounded up to seconds.
+	w := httptest.NewRecorder()
+	gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {},
+		gear.Maintenance(&enabled, &gear.MaintenanceOptions{RetryAfter: 100 * time.Millisecond})).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "1" {
+		t.Fatal(retryAfter)
+	}
+}
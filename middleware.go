@@ -2,8 +2,14 @@ package gear
 
 import (
 	"context"
+	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync/atomic"
 
 	"github.com/mkch/gg"
 	runtimegg "github.com/mkch/gg/runtime"
@@ -22,25 +28,62 @@ type MiddlewareName interface {
 	MiddlewareName() string
 }
 
+// PanicRecoveryOptions are options for [PanicRecoveryWithOptions].
+// A zero PanicRecoveryOptions consists entirely of zero values.
+type PanicRecoveryOptions struct {
+	// Level is the level of the panic log.
+	// Zero value(nil) means slog.LevelError.
+	Level slog.Leveler
+	// Message is the message of the panic log.
+	// Zero value means "recovered from panic".
+	Message string
+	// AddStack makes the "stack" attribute set to the string representation of the call stack.
+	// Zero value means no "stack" attribute.
+	AddStack bool
+	// AddRequest makes the "method" and "URL" attributes set to the method and URL of the request,
+	// and the "request_id" attribute set to the [RequestIDHeader] header of the request if present
+	// and no ID is assigned by [RequestID].
+	// Zero value means no request attributes, except "request_id" if assigned by RequestID.
+	AddRequest bool
+	// Render sends the response after the panic is logged. v is the panic value.
+	// It is useful to send a JSON error body for JSON APIs, for example.
+	// Zero value means a plain text http.StatusInternalServerError response sent by [Gear.Code].
+	Render func(g *Gear, v any)
+}
+
 // panicRecovery is the default [Middleware] recovers from panics.
 // It sends 500 response.
 type panicRecovery struct {
-	// Whether add "stack" attribute.
-	addStack bool
+	level      slog.Leveler
+	message    string
+	addStack   bool // Whether add "stack" attribute.
+	addRequest bool // Whether add "method", "URL" and "request_id" attributes.
+	render     func(g *Gear, v any)
 }
 
+// RequestIDHeader is the HTTP header carrying the request ID.
+const RequestIDHeader = "X-Request-Id"
+
 // Serve implements [Middleware].
-func (p panicRecovery) Serve(g *Gear, next func(*Gear)) {
+func (p *panicRecovery) Serve(g *Gear, next func(*Gear)) {
 	defer func() {
 		v := recover()
 		if v != nil {
-			var attrs = make([]slog.Attr, 0, gg.If(p.addStack, 2, 1))
+			var attrs = make([]slog.Attr, 0, 4)
 			attrs = append(attrs, slog.Any("value", v))
 			if p.addStack {
 				attrs = append(attrs, slog.Any("stack", runtimegg.Stack(1, 0))) // 1: skip this anonymous function.
 			}
-			RawLogger.LogAttrs(context.Background(), slog.LevelError, "recovered from panic", attrs...)
-			g.Code(http.StatusInternalServerError)
+			var id = requestIDFromContext(g.R.Context())
+			if p.addRequest {
+				attrs = append(attrs, slog.String(LoggerMethodKey, g.R.Method), slog.String(LoggerURLKey, g.R.URL.String()))
+				id = requestID(g.R)
+			}
+			if id != "" {
+				attrs = append(attrs, slog.String(LoggerRequestIDKey, id))
+			}
+			RawLogger.LogAttrs(context.Background(), p.level.Level(), p.message, attrs...)
+			p.render(g, v)
 			g.Stop()
 		}
 	}()
@@ -48,7 +91,7 @@ func (p panicRecovery) Serve(g *Gear, next func(*Gear)) {
 }
 
 // MiddlewareName implements [MiddlewareName].
-func (p panicRecovery) MiddlewareName() string {
+func (p *panicRecovery) MiddlewareName() string {
 	return "PanicRecover"
 }
 
@@ -56,17 +99,53 @@ func (p panicRecovery) MiddlewareName() string {
 // logs a LevelError message "recovered from panic" and sends 500 responses.
 // The "value" attribute is set to panic value.
 // If addStack is true, "stack" attribute is set to the string representation of the call stack.
+// The "method", "URL" and "request_id"(if present, see [RequestID]) attributes are set to correlate the log to the request,
+// use [PanicRecoveryWithOptions] to turn them off.
 // Panic recovery middleware should be added as the last middleware to catch all panics.
 func PanicRecovery(addStack bool) Middleware {
-	return panicRecovery{addStack}
+	return PanicRecoveryWithOptions(&PanicRecoveryOptions{AddStack: addStack, AddRequest: true})
+}
+
+// renderPanic is the default value of [PanicRecoveryOptions].Render.
+func renderPanic(g *Gear, v any) {
+	g.Code(http.StatusInternalServerError)
+}
+
+// PanicRecoveryWithOptions is like [PanicRecovery] but the log and the response are customized by opt.
+// If opt is nil, the options of PanicRecovery(false) are used, that is, the request attributes are added.
+func PanicRecoveryWithOptions(opt *PanicRecoveryOptions) Middleware {
+	var p = &panicRecovery{level: slog.LevelError, message: "recovered from panic", addRequest: true, render: renderPanic}
+	if opt != nil {
+		if opt.Level != nil {
+			p.level = opt.Level
+		}
+		if opt.Message != "" {
+			p.message = opt.Message
+		}
+		p.addStack = opt.AddStack
+		p.addRequest = opt.AddRequest
+		if opt.Render != nil {
+			p.render = opt.Render
+		}
+	}
+	return p
+}
+
+// MiddlewareNameOf returns the name of m. If m implements [MiddlewareName],
+// the return value of MiddlewareName() is used, or the reflect type name of m.
+func MiddlewareNameOf(m Middleware) string {
+	if n, ok := m.(MiddlewareName); ok {
+		return n.MiddlewareName()
+	}
+	return reflect.TypeOf(m).String()
 }
 
-// func middlewareName(m Middleware) string {
-// 	if n, ok := m.(MiddlewareName); ok {
-// 		return n.MiddlewareName()
-// 	}
-// 	return reflect.TypeOf(m).String()
-// }
+// DebugChain makes the middleware chains log the name(see [MiddlewareNameOf]) of each middleware
+// as it enters and exits, and whether [Gear.Stop] has been called, at [slog.LevelDebug] with [RawLogger].
+// It is useful to trace which middleware stopped a request.
+//
+// It's not safe to set DebugChain concurrently with serving requests.
+var DebugChain = false
 
 // middlewareFunc wraps f and it's middleware name.
 // Used by MiddlewareFunc() function.
@@ -132,7 +211,15 @@ func (m *mwExec) exec(g *Gear) {
 
 // serveMiddlewares executes m.middlewares.
 func (m *mwExec) serveMiddlewares(g *Gear) {
-	m.middlewares[m.i].Serve(g, func(g *Gear) {
+	var mw = m.middlewares[m.i]
+	if DebugChain {
+		var name = MiddlewareNameOf(mw)
+		RawLogger.Debug("enter middleware", "name", name)
+		defer func() {
+			RawLogger.Debug("exit middleware", "name", name, "stopped", g.stopped)
+		}()
+	}
+	mw.Serve(g, func(g *Gear) {
 		if g.stopped {
 			return
 		}
@@ -158,6 +245,27 @@ const (
 	// LoggerMethodKey is the group key used by [Logger] for the header of HTTP request.
 	// The associated Value in group is a string.
 	LoggerHeaderKey = "header"
+	// LoggerRouteKey is the key used by [Logger] for the matched route pattern, see [Gear.Pattern].
+	// If it is logged, the log is written after the request is handled, when the pattern is known.
+	// The associated Value is a string.
+	LoggerRouteKey = "route"
+	// LoggerStatusKey is the key used by [Logger] for the status code of HTTP response.
+	// If it is logged, the log is written after the request is handled.
+	// The associated Value is an int.
+	LoggerStatusKey = "status"
+	// LoggerRequestSizeKey is the key used by [Logger] for the size of HTTP request body:
+	// the Content-Length of the request if known, or the number of bytes read by the handler otherwise.
+	// If it is logged, the log is written after the request is handled.
+	// The associated Value is an int64.
+	LoggerRequestSizeKey = "request_size"
+	// LoggerResponseSizeKey is the key used by [Logger] for the number of bytes written to HTTP response body.
+	// If it is logged, the log is written after the request is handled.
+	// The associated Value is an int64.
+	LoggerResponseSizeKey = "response_size"
+	// LoggerRequestIDKey is the key used by [Logger] for the request ID assigned by [RequestID].
+	// It is not logged if the request has no ID.
+	// The associated Value is a string.
+	LoggerRequestIDKey = "request_id"
 )
 
 // LoggerOptions are options for [Logger]. A zero LoggerOptions consists entirely of zero values.
@@ -169,17 +277,60 @@ type LoggerOptions struct {
 	// HeaderKeys are only used when LoggerHeaderKey is in Keys.
 	// Zero value means not logging any header value.
 	HeaderKeys []string
+	// ExpandURL makes the Logger log the URL as a group of string attributes
+	// "path", "query", "host" and "scheme", which is cleaner in structured logs.
+	// Zero value means the URL is logged as a single value.
+	ExpandURL bool
 	// Attrs can be used to generate the slog.Attr slice to log for r.
 	// If Attrs is not nil, all fields above are ignored, the Logger just
 	// calls LogAttrs() to log the return value of this function.
 	// This function should not retain or modify r.
 	Attrs func(r *http.Request) []slog.Attr
+	// SampleRate is the fraction(0..1) of requests to log.
+	// The requests not sampled are still logged if the response status is 500 or above,
+	// in which case the log is written after the request is handled.
+	// Zero value(or any value not in range (0, 1)) means all requests are logged.
+	SampleRate float64
+	// LevelFunc returns the log level for the response status code, [StatusLevel] for example.
+	// If LevelFunc is not nil, the log is written after the request is handled.
+	// Zero value means all requests are logged at LevelInfo.
+	LevelFunc func(status int) slog.Level
+}
+
+// StatusLevel maps status code to log level: 5xx to LevelError, 4xx to LevelWarn and others to LevelInfo.
+// It can be used as [LoggerOptions].LevelFunc.
+func StatusLevel(status int) slog.Level {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// expandURL returns the URL of r as a group attribute, see [LoggerOptions.ExpandURL].
+func expandURL(r *http.Request) slog.Attr {
+	var host = r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+	var scheme = r.URL.Scheme
+	if scheme == "" {
+		scheme = gg.If(r.TLS != nil, "https", "http")
+	}
+	return slog.Group(LoggerURLKey,
+		slog.String("path", r.URL.Path),
+		slog.String("query", r.URL.RawQuery),
+		slog.String("host", host),
+		slog.String("scheme", scheme))
 }
 
 // Logger returns a [Middleware] to log HTTP access log.
 // If opt is nil, the default options are used.
 //
-// Log level: LevelInfo
+// Log level: LevelInfo, or the return value of LevelFunc of opt.
 //
 // Log attributes:
 //
@@ -188,49 +339,354 @@ type LoggerOptions struct {
 //	"host": request.Host
 //	"URL": request.URL
 //	"header.headerKey": request.Header[headerKey]
+//	"route": matched route pattern(see [Gear.Pattern])
+//	"status": response status code
+//	"request_size": request body size
+//	"response_size": response body size
+//	"request_id": request ID assigned by [RequestID], if any
+//
+// The log is written before the request is handled, unless any of "route", "status", "request_size"
+// and "response_size" is logged, LevelFunc of opt is set, or the request is not sampled(see SampleRate of opt).
+// In such cases, the log is written even if the handler panics, with status http.StatusInternalServerError
+// if no response has been written, so the panicking requests are recorded.
+//
+// If ExpandURL of opt is true, "URL" is a group:
+//
+//	"URL.path": request.URL.Path
+//	"URL.query": request.URL.RawQuery
+//	"URL.host": request.URL.Host, or request.Host if empty
+//	"URL.scheme": request.URL.Scheme, or "http"/"https" if empty
 func Logger(opt *LoggerOptions) Middleware {
+	var keyEnabled = func(key string) bool {
+		return opt == nil || (opt.Attrs == nil && (opt.Keys == nil || opt.Keys[key]))
+	}
+	var logRoute = keyEnabled(LoggerRouteKey)
+	var logStatus = keyEnabled(LoggerStatusKey)
+	var logRequestSize = keyEnabled(LoggerRequestSizeKey)
+	var logResponseSize = keyEnabled(LoggerResponseSizeKey)
+	var logAfter = logRoute || logStatus || logRequestSize || logResponseSize
+	var levelFunc func(int) slog.Level
+	if opt != nil {
+		levelFunc = opt.LevelFunc
+	}
 	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
-		var attrs []slog.Attr
-		if opt != nil && opt.Attrs != nil { // opt.Attrs takes precedency.
-			attrs = opt.Attrs(g.R)
-		} else {
-			// Default values.
-			var headerKeys []string
-			var logMethod = true
-			var logHost = true
-			var logURL = true
-			// Values in options.
-			if opt != nil {
-				var logHeader = true
-				if opt.Keys != nil {
-					logMethod = opt.Keys[LoggerMethodKey]
-					logHost = opt.Keys[LoggerHostKey]
-					logURL = opt.Keys[LoggerURLKey]
-					logHeader = opt.Keys[LoggerHeaderKey]
-				}
-				if logHeader && opt.HeaderKeys != nil {
-					headerKeys = opt.HeaderKeys
-				}
+		var sampled = opt == nil || opt.SampleRate <= 0 || opt.SampleRate >= 1 || rand.Float64() < opt.SampleRate
+		if sampled && levelFunc == nil && !logAfter {
+			RawLogger.LogAttrs(context.Background(), slog.LevelInfo, "HTTP", loggerAttrs(opt, g.R)...)
+			next(g)
+			return
+		}
+		// Log after the request is handled.
+		var w = g.W
+		var cw = newCaptureWriter(w, 0)
+		g.W = cw
+		var requestSize = g.R.ContentLength
+		var body *countingReader
+		if logRequestSize && requestSize < 0 && g.R.Body != nil {
+			body = &countingReader{ReadCloser: g.R.Body}
+			g.R.Body = body
+		}
+		var completed bool // Whether next returns normally.
+		defer func() {
+			g.W = w
+			if body != nil {
+				g.R.Body = body.ReadCloser
+				requestSize = body.n
 			}
-			attrs = make([]slog.Attr, 0, 3+gg.If(len(headerKeys) > 0, 1, 0)) // 3: method, host, URL
-			if logMethod {
-				attrs = append(attrs, slog.String(LoggerMethodKey, g.R.Method))
+			var status = cw.status()
+			if !completed && cw.statusCode == 0 {
+				status = http.StatusInternalServerError // Panicking, the response is written by the recovery.
 			}
-			if logHost {
-				attrs = append(attrs, slog.String(LoggerHostKey, g.R.Host))
+			if !sampled && status < http.StatusInternalServerError {
+				return // Not sampled, only log server errors.
 			}
-			if logURL {
-				attrs = append(attrs, slog.Any(LoggerURLKey, g.R.URL))
+			var level = slog.LevelInfo
+			if levelFunc != nil {
+				level = levelFunc(status)
 			}
-			if len(headerKeys) > 0 {
-				var headers []any = make([]any, 0, len(headerKeys))
-				for _, key := range headerKeys {
-					headers = append(headers, slog.Any(key, g.R.Header[key]))
-				}
-				attrs = append(attrs, slog.Group(LoggerHeaderKey, headers...))
+			var attrs = loggerAttrs(opt, g.R)
+			if logRoute {
+				attrs = append(attrs, slog.String(LoggerRouteKey, g.Pattern()))
 			}
-		}
-		RawLogger.LogAttrs(context.Background(), slog.LevelInfo, "HTTP", attrs...)
+			if logStatus {
+				attrs = append(attrs, slog.Int(LoggerStatusKey, status))
+			}
+			if logRequestSize {
+				attrs = append(attrs, slog.Int64(LoggerRequestSizeKey, max(requestSize, 0)))
+			}
+			if logResponseSize {
+				attrs = append(attrs, slog.Int64(LoggerResponseSizeKey, cw.written))
+			}
+			RawLogger.LogAttrs(context.Background(), level, "HTTP", attrs...)
+		}()
 		next(g)
+		completed = true
 	}, "Logger")
 }
+
+// countingReader is an io.ReadCloser which counts the bytes read.
+type countingReader struct {
+	io.ReadCloser
+	n int64 // Number of bytes read.
+}
+
+// Read implements [io.Reader].
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return
+}
+
+// loggerAttrs returns the attributes to log for r by [Logger].
+func loggerAttrs(opt *LoggerOptions, r *http.Request) (attrs []slog.Attr) {
+	if opt != nil && opt.Attrs != nil { // opt.Attrs takes precedency.
+		return opt.Attrs(r)
+	}
+	// Default values.
+	var headerKeys []string
+	var logMethod = true
+	var logHost = true
+	var logURL = true
+	var logRequestID = true
+	// Values in options.
+	if opt != nil {
+		var logHeader = true
+		if opt.Keys != nil {
+			logMethod = opt.Keys[LoggerMethodKey]
+			logHost = opt.Keys[LoggerHostKey]
+			logURL = opt.Keys[LoggerURLKey]
+			logHeader = opt.Keys[LoggerHeaderKey]
+			logRequestID = opt.Keys[LoggerRequestIDKey]
+		}
+		if logHeader && opt.HeaderKeys != nil {
+			headerKeys = opt.HeaderKeys
+		}
+	}
+	attrs = make([]slog.Attr, 0, 4+gg.If(len(headerKeys) > 0, 1, 0)) // 4: method, host, URL, request_id
+	if logMethod {
+		attrs = append(attrs, slog.String(LoggerMethodKey, r.Method))
+	}
+	if logHost {
+		attrs = append(attrs, slog.String(LoggerHostKey, r.Host))
+	}
+	if logURL {
+		if opt != nil && opt.ExpandURL {
+			attrs = append(attrs, expandURL(r))
+		} else {
+			attrs = append(attrs, slog.Any(LoggerURLKey, r.URL))
+		}
+	}
+	if logRequestID {
+		if id := requestIDFromContext(r.Context()); id != "" {
+			attrs = append(attrs, slog.String(LoggerRequestIDKey, id))
+		}
+	}
+	if len(headerKeys) > 0 {
+		var headers []any = make([]any, 0, len(headerKeys))
+		for _, key := range headerKeys {
+			headers = append(headers, slog.Any(key, r.Header[key]))
+		}
+		attrs = append(attrs, slog.Group(LoggerHeaderKey, headers...))
+	}
+	return
+}
+
+// SlashMode is the mode of [RedirectSlash].
+type SlashMode int
+
+const (
+	// AddSlash redirects paths without a trailing slash to the ones with it.
+	AddSlash SlashMode = iota
+	// StripSlash redirects paths with a trailing slash to the ones without it.
+	StripSlash
+)
+
+// routeMatches returns whether the request r with path p matches a route of mux.
+func routeMatches(mux *http.ServeMux, r *http.Request, p string) bool {
+	var u = *r.URL
+	u.Path, u.RawPath = p, ""
+	var r2 = *r
+	r2.URL = &u
+	_, pattern := mux.Handler(&r2)
+	return pattern != ""
+}
+
+// RedirectSlashOptions are options for [RedirectSlash].
+// A zero RedirectSlashOptions consists entirely of zero values.
+type RedirectSlashOptions struct {
+	// Mux is the mux the routes are registered in. If set, the request is redirected only when
+	// the current path doesn't match any route of Mux but the alternate does.
+	// Zero value means the routes are unknown, and all the requests of non-canonical path are redirected,
+	// whether the alternate path matches or not.
+	Mux *http.ServeMux
+}
+
+// RedirectSlash returns a [Middleware] which redirects the request to the canonical
+// form of the path with http.StatusMovedPermanently, adding or stripping the trailing slash
+// according to mode. Query string is preserved. Only GET and HEAD requests are redirected.
+// Leading slashes of the redirect target are collapsed to one, so paths such as "//example.com"
+// are never redirected to another host.
+// Set [RedirectSlashOptions].Mux to redirect only the paths whose alternate matches a route.
+// If opt is nil, the default options are used.
+func RedirectSlash(mode SlashMode, opt *RedirectSlashOptions) Middleware {
+	var mux *http.ServeMux
+	if opt != nil {
+		mux = opt.Mux
+	}
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		if g.R.Method != http.MethodGet && g.R.Method != http.MethodHead {
+			next(g)
+			return
+		}
+		var p = g.R.URL.Path
+		var alt, escapedAlt string
+		switch mode {
+		case AddSlash:
+			if strings.HasSuffix(p, "/") {
+				next(g)
+				return
+			}
+			alt, escapedAlt = p+"/", g.R.URL.EscapedPath()+"/"
+		case StripSlash:
+			if p == "/" || !strings.HasSuffix(p, "/") {
+				next(g)
+				return
+			}
+			alt, escapedAlt = strings.TrimSuffix(p, "/"), strings.TrimSuffix(g.R.URL.EscapedPath(), "/")
+		default:
+			next(g)
+			return
+		}
+		if mux != nil && (routeMatches(mux, g.R, p) || !routeMatches(mux, g.R, alt)) {
+			next(g)
+			return
+		}
+		// "//host/path" is a network-path reference to another host.
+		escapedAlt = "/" + strings.TrimLeft(escapedAlt, "/")
+		if g.R.URL.RawQuery != "" {
+			escapedAlt += "?" + g.R.URL.RawQuery
+		}
+		http.Redirect(g.W, g.R, escapedAlt, http.StatusMovedPermanently)
+		g.Stop()
+	}, "RedirectSlash")
+}
+
+// CleanPathOptions are options for [CleanPath]. A zero CleanPathOptions consists entirely of zero values.
+type CleanPathOptions struct {
+	// Lowercase makes the path lowercased as well.
+	// Zero value means the case is preserved.
+	Lowercase bool
+}
+
+// cleanPath returns the canonical form of p: [path.Clean] applied, the trailing slash preserved,
+// and lowercased if lowercase is true.
+func cleanPath(p string, lowercase bool) string {
+	var cleaned = path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	if lowercase {
+		cleaned = strings.ToLower(cleaned)
+	}
+	return cleaned
+}
+
+// CleanPath returns a [Middleware] which normalizes the request path: duplicate slashes are collapsed,
+// "." and ".." elements are resolved(see [path.Clean]), and optionally the path is lowercased.
+// The trailing slash, if any, is preserved. GET and HEAD requests of non-canonical path are redirected
+// to the canonical form with http.StatusMovedPermanently, query string preserved.
+// Requests of other methods are rewritten in place(see [Gear.SetRequest]), so the downstream
+// middlewares and handler never see malformed paths such as "/a//b/../c".
+// If opt is nil, the default options are used.
+func CleanPath(opt *CleanPathOptions) Middleware {
+	var lowercase = opt != nil && opt.Lowercase
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var p = g.R.URL.Path
+		var cleaned = cleanPath(p, lowercase)
+		if cleaned == p {
+			next(g)
+			return
+		}
+		var u = *g.R.URL
+		u.Path, u.RawPath = cleaned, ""
+		if g.R.Method == http.MethodGet || g.R.Method == http.MethodHead {
+			var target = u.EscapedPath()
+			if u.RawQuery != "" {
+				target += "?" + u.RawQuery
+			}
+			http.Redirect(g.W, g.R, target, http.StatusMovedPermanently)
+			g.Stop()
+			return
+		}
+		var r = g.R.Clone(g.R.Context())
+		r.URL = &u
+		g.SetRequest(r)
+		next(g)
+	}, "CleanPath")
+}
+
+// MethodOverrideHeader is the request header used by [MethodOverride].
+const MethodOverrideHeader = "X-HTTP-Method-Override"
+
+// MethodOverrideField is the form field used by [MethodOverride].
+const MethodOverrideField = "_method"
+
+// MethodOverride returns a [Middleware] which lets POST requests, such as HTML form submissions,
+// act as PUT, PATCH or DELETE requests. The method is read from X-HTTP-Method-Override header,
+// or the "_method" form field(which parses the request body) if the header is absent,
+// and g.R is replaced with a request of that method(see [Gear.SetRequest]).
+// Other methods are ignored. Use [Gear.OriginalMethod] to get the method on the wire.
+func MethodOverride() Middleware {
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		if g.R.Method != http.MethodPost {
+			next(g)
+			return
+		}
+		var method = g.R.Header.Get(MethodOverrideHeader)
+		if method == "" {
+			method = g.R.PostFormValue(MethodOverrideField)
+		}
+		method = strings.ToUpper(method)
+		switch method {
+		case http.MethodPut, http.MethodPatch, http.MethodDelete:
+			r := g.R.WithContext(g.R.Context())
+			r.Method = method
+			g.method = g.R.Method
+			g.SetRequest(r)
+		}
+		next(g)
+	}, "MethodOverride")
+}
+
+// DefaultContentType returns a [Middleware] which sets Content-Type header of the response
+// to ct if the handler hasn't set it by the time the header is written, which
+// prevents the content type from being sniffed from the response body.
+func DefaultContentType(ct string) Middleware {
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var w = g.W
+		g.W = newHookWriter(w, func(w http.ResponseWriter) {
+			if w.Header().Get("Content-Type") == "" {
+				w.Header().Set("Content-Type", ct)
+			}
+		})
+		defer func() { g.W = w }()
+		next(g)
+	}, "DefaultContentType")
+}
+
+// Draining returns a [Middleware] which rejects new requests while the server is draining.
+// When drain is set, the request gets a http.StatusServiceUnavailable response with
+// "Connection: close" header immediately, and the middleware processing is stopped.
+// Setting drain before calling [http.Server.Shutdown] lets load balancers drain
+// the server cleanly while the in-flight requests finish.
+func Draining(drain *atomic.Bool) Middleware {
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		if drain.Load() {
+			g.W.Header().Set("Connection", "close")
+			g.Code(http.StatusServiceUnavailable)
+			g.Stop()
+			return
+		}
+		next(g)
+	}, "Draining")
+}
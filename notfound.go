@@ -0,0 +1,158 @@
+package gear
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mkch/gear/encoding"
+)
+
+// mimeHTML and mimeText are the media types negotiated by [NotFoundHandler] besides JSON.
+const (
+	mimeHTML = "text/html"
+	mimeText = "text/plain"
+)
+
+// NotFoundOptions are options for [NotFoundHandler] and [MethodNotAllowedHandler].
+// A zero NotFoundOptions consists entirely of zero values.
+type NotFoundOptions struct {
+	// Message is the human-readable message of the response.
+	// Zero value means the status text of the status code.
+	Message string
+	// JSON writes the response with status code to the clients preferring JSON.
+	// Zero value means RFC 7807 problem details written by [Gear.Problem].
+	JSON func(g *Gear, code int)
+	// HTML writes the response with status code to the clients preferring HTML, browsers for example.
+	// Zero value means a minimal HTML page showing the message.
+	HTML func(g *Gear, code int)
+}
+
+// negotiateMediaType returns the media type in offers to use for the Accept header value accept,
+// or "" if there is none acceptable. Media ranges such as "text/*" and "*/*" are supported.
+// The type with the highest quality value wins, and ties are broken by the order in offers.
+// If accept is empty, the first offer is returned.
+func negotiateMediaType(accept string, offers []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	var best string
+	var bestQ float64
+	for _, offer := range offers {
+		var q, specificity = 0.0, -1 // The quality of the most specific range matching offer.
+		for _, item := range strings.Split(accept, ",") {
+			mediaRange, params, _ := strings.Cut(item, ";")
+			mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+			var s int
+			switch {
+			case mediaRange == offer:
+				s = 2
+			case strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(offer, mediaRange[:len(mediaRange)-1]):
+				s = 1
+			case mediaRange == "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s <= specificity {
+				continue
+			}
+			specificity, q = s, 1.0
+			for _, param := range strings.Split(params, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(k) == "q" {
+					if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+						q = f
+					}
+				}
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// statusHandler is the http.Handler returned by [NotFoundHandler] and [MethodNotAllowedHandler].
+type statusHandler struct {
+	code    int
+	message string
+	json    func(g *Gear, code int)
+	html    func(g *Gear, code int)
+}
+
+// newStatusHandler returns a statusHandler responding code, customized by opt.
+func newStatusHandler(code int, opt *NotFoundOptions) *statusHandler {
+	var h = &statusHandler{code: code, message: http.StatusText(code)}
+	h.json = h.writeJSON
+	h.html = h.writeHTML
+	if opt != nil {
+		if opt.Message != "" {
+			h.message = opt.Message
+		}
+		if opt.JSON != nil {
+			h.json = opt.JSON
+		}
+		if opt.HTML != nil {
+			h.html = opt.HTML
+		}
+	}
+	return h
+}
+
+// writeJSON is the default JSON response.
+func (h *statusHandler) writeJSON(g *Gear, code int) {
+	var p = Problem{Instance: g.R.URL.Path}
+	if h.message != http.StatusText(code) {
+		p.Detail = h.message
+	}
+	LogIfErr(g.Problem(code, p))
+}
+
+// writeHTML is the default HTML response.
+func (h *statusHandler) writeHTML(g *Gear, code int) {
+	var message = html.EscapeString(h.message)
+	g.W.Header().Set("Content-Type", mimeHTML+"; charset=utf-8")
+	g.W.Header().Set("X-Content-Type-Options", "nosniff")
+	g.W.WriteHeader(code)
+	LogIfErr(g.String("<!DOCTYPE html>\n<html><head><title>" + message + "</title></head><body><h1>" + message + "</h1></body></html>\n"))
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *statusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var g, ok = getGear(r).(*Gear)
+	if !ok {
+		g = newGear(w, r)
+	}
+	var gw = g.W
+	g.W = w
+	defer func() { g.W = gw }()
+	switch negotiateMediaType(r.Header.Get("Accept"), []string{encoding.MIME_JSON, mimeHTML, mimeText}) {
+	case encoding.MIME_JSON:
+		h.json(g, h.code)
+	case mimeHTML:
+		h.html(g, h.code)
+	default:
+		http.Error(w, h.message, h.code)
+	}
+}
+
+// NotFoundHandler returns a http.Handler which responds http.StatusNotFound in the format negotiated
+// from Accept header of the request: JSON for API clients, HTML for browsers and plain text otherwise.
+// JSON is preferred if the client accepts any type, and used if there is no Accept header.
+// It can be registered as the fallback of a mux, or as the notFound handler of [WrapWithNotFound]:
+//
+//	mux.Handle("/", gear.NotFoundHandler(nil))
+//	http.ListenAndServe(":80", gear.WrapWithNotFound(mux, gear.NotFoundHandler(nil)))
+//
+// If opt is nil, the default options are used.
+func NotFoundHandler(opt *NotFoundOptions) http.Handler {
+	return newStatusHandler(http.StatusNotFound, opt)
+}
+
+// MethodNotAllowedHandler is like [NotFoundHandler], but responds http.StatusMethodNotAllowed.
+// The Allow header of the response, if set before, is kept.
+func MethodNotAllowedHandler(opt *NotFoundOptions) http.Handler {
+	return newStatusHandler(http.StatusMethodNotAllowed, opt)
+}
@@ -0,0 +1,54 @@
+package gear_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gear/encoding"
+	"github.com/mkch/gear/internal/geartest"
+)
+
+func TestNotFoundHandler(t *testing.T) {
+	var mux http.ServeMux
+	mux.HandleFunc("GET /a", func(w http.ResponseWriter, r *http.Request) {})
+	client := geartest.NewClient(gear.WrapWithNotFound(&mux, gear.NotFoundHandler(nil)))
+
+	for _, test := range []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{"", encoding.MIME_PROBLEM_JSON, `{"instance":"/b","status":404,"title":"Not Found"}` + "\n"},
+		{"*/*", encoding.MIME_PROBLEM_JSON, `{"instance":"/b","status":404,"title":"Not Found"}` + "\n"},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8", "<h1>Not Found</h1>"},
+		{"text/*", "text/html; charset=utf-8", "<h1>Not Found</h1>"},
+		{"text/plain, application/json;q=0.5", "text/plain; charset=utf-8", "Not Found\n"},
+		{"image/png", "text/plain; charset=utf-8", "Not Found\n"},
+	} {
+		resp := client.Request(http.MethodGet, "/b").Header("Accept", test.accept).Do()
+		if resp.StatusCode != http.StatusNotFound || resp.Header.Get("Content-Type") != test.contentType || !strings.Contains(string(resp.Body), test.body) {
+			t.Fatal(test.accept, resp.StatusCode, resp.Header, string(resp.Body))
+		}
+	}
+	if resp := client.Get("/a"); resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.StatusCode)
+	}
+}
+
+func TestMethodNotAllowedHandler(t *testing.T) {
+	handler := gear.MethodNotAllowedHandler(&gear.NotFoundOptions{
+		Message: "<nope>",
+		JSON: func(g *gear.Gear, code int) {
+			g.JSONResponse(code, map[string]string{"error": "nope"})
+		},
+	})
+	client := geartest.NewClient(handler) // Without Gear.
+	if resp := client.Request(http.MethodPost, "/").Header("Accept", "application/json").Do(); resp.StatusCode != http.StatusMethodNotAllowed || string(resp.Body) != `{"error":"nope"}`+"\n" {
+		t.Fatal(resp.StatusCode, string(resp.Body))
+	}
+	if resp := client.Request(http.MethodPost, "/").Header("Accept", "text/html").Do(); !strings.Contains(string(resp.Body), "<h1>&lt;nope&gt;</h1>") {
+		t.Fatal(string(resp.Body))
+	}
+}
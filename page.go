@@ -0,0 +1,35 @@
+package gear
+
+// PageMeta is the pagination metadata in the default envelope of [Gear.Page].
+type PageMeta struct {
+	Total      int `json:"total"`
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalPages int `json:"total_pages"`
+}
+
+// defaultPageEnvelope is the default value of PageEnvelope.
+type defaultPageEnvelope struct {
+	Data any      `json:"data"`
+	Meta PageMeta `json:"meta"`
+}
+
+// PageEnvelope builds the value written by [Gear.Page] as JSON.
+// It can be replaced to match the API conventions. The default one builds:
+//
+//	{"data": items, "meta": {"total": total, "page": page, "per_page": perPage, "total_pages": totalPages}}
+//
+// where totalPages is total divided by perPage rounded up, or 0 if perPage <= 0.
+var PageEnvelope = func(items any, total, page, perPage int) any {
+	var totalPages int
+	if perPage > 0 {
+		totalPages = (total + perPage - 1) / perPage
+	}
+	return &defaultPageEnvelope{items, PageMeta{total, page, perPage, totalPages}}
+}
+
+// Page writes code and JSON encoding of a paginated response to the response.
+// The response is built by [PageEnvelope] with items, total, page and perPage.
+func (g *Gear) Page(code int, items any, total, page, perPage int) error {
+	return g.JSONResponse(code, PageEnvelope(items, total, page, perPage))
+}
@@ -0,0 +1,170 @@
+package gear
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mkch/gear/encoding"
+)
+
+// decodeParam converts values to T using [encoding.DecodeValues].
+// If values is empty, the zero value of T and nil error are returned.
+func decodeParam[T any](key string, values []string) (v T, err error) {
+	if len(values) == 0 {
+		return
+	}
+	if err = encoding.DecodeValues(values, &v); err != nil {
+		var fieldErr *encoding.DecodeFieldError
+		if errors.As(err, &fieldErr) {
+			fieldErr.Name = key
+		}
+	}
+	return
+}
+
+// Query returns the value associated with key in the URL query of the request, converted to T.
+// The conversion is the same as decoding a struct field of type T, see [encoding.MapDecoder].
+// If T is a slice, all the values of key are converted, otherwise only the first one.
+// If the key is not present, Query returns the zero value of T and nil error.
+//
+//	page, err := gear.Query[int](g, "page")
+func Query[T any](g *Gear, key string) (T, error) {
+	return decodeParam[T](key, g.Query()[key])
+}
+
+// Path returns the value of the named path wildcard(see [http.Request.PathValue]) of the request, converted to T.
+// The conversion is the same as decoding a struct field of type T, see [encoding.MapDecoder].
+// If there is no such wildcard or the value is empty, Path returns the zero value of T and nil error.
+//
+//	id, err := gear.Path[int64](g, "id")
+func Path[T any](g *Gear, key string) (T, error) {
+	var values []string
+	if value := g.R.PathValue(key); value != "" {
+		values = []string{value}
+	}
+	return decodeParam[T](key, values)
+}
+
+// Header returns the value associated with key in the header of the request, converted to T.
+// The conversion is the same as decoding a struct field of type T, see [encoding.MapDecoder].
+// If T is a slice, all the values of key are converted, otherwise only the first one.
+// If the key is not present, Header returns the zero value of T and nil error.
+// Use [encoding.HTTPDate] as T for HTTP dates.
+//
+//	remaining, err := gear.Header[int](g, "X-RateLimit-Remaining")
+func Header[T any](g *Gear, key string) (T, error) {
+	return decodeParam[T](key, g.R.Header.Values(key))
+}
+
+// HeaderInt returns the value associated with key in the header of the request converted to int,
+// and whether the key is present and the conversion succeeds. See [Header].
+func (g *Gear) HeaderInt(key string) (v int, ok bool) {
+	if len(g.R.Header.Values(key)) == 0 {
+		return
+	}
+	v, err := Header[int](g, key)
+	return v, err == nil
+}
+
+// HeaderTime returns the value associated with key in the header of the request parsed
+// as HTTP date(see [http.ParseTime]), and whether the key is present and the parsing succeeds.
+func (g *Gear) HeaderTime(key string) (t time.Time, ok bool) {
+	v := g.R.Header.Get(key)
+	if v == "" {
+		return
+	}
+	t, err := http.ParseTime(v)
+	return t, err == nil
+}
+
+// MissingPathValueError is returned by [RequiredPath] and the Gear.Path* methods
+// if the named path wildcard is absent or empty.
+type MissingPathValueError string
+
+func (err MissingPathValueError) Error() string {
+	return fmt.Sprintf("gear: missing path value %q", string(err))
+}
+
+// RequiredPath is like [Path], but a [MissingPathValueError] is returned if there is no such wildcard
+// or the value is empty, instead of the zero value of T.
+//
+//	id, err := gear.RequiredPath[int64](g, "id")
+func RequiredPath[T any](g *Gear, key string) (v T, err error) {
+	if g.R.PathValue(key) == "" {
+		err = MissingPathValueError(key)
+		return
+	}
+	return Path[T](g, key)
+}
+
+// PathInt returns the value of the named path wildcard converted to int, see [RequiredPath].
+func (g *Gear) PathInt(key string) (int, error) {
+	return RequiredPath[int](g, key)
+}
+
+// PathInt64 returns the value of the named path wildcard converted to int64, see [RequiredPath].
+func (g *Gear) PathInt64(key string) (int64, error) {
+	return RequiredPath[int64](g, key)
+}
+
+// PathString returns the value of the named path wildcard, see [RequiredPath].
+func (g *Gear) PathString(key string) (string, error) {
+	return RequiredPath[string](g, key)
+}
+
+// MustPathInt calls [Gear.PathInt]. If PathInt returns an error, MustPathInt returns it but also
+// writes a http.StatusBadRequest response(see [DecodeErrorHandler]) and stops the middleware processing.
+func (g *Gear) MustPathInt(key string) (v int, err error) {
+	err = mustDecode(g, func(g *Gear, _ any) (err error) {
+		v, err = g.PathInt(key)
+		return
+	}, nil)
+	return
+}
+
+// MustPathInt64 calls [Gear.PathInt64]. If PathInt64 returns an error, MustPathInt64 returns it but also
+// writes a http.StatusBadRequest response(see [DecodeErrorHandler]) and stops the middleware processing.
+func (g *Gear) MustPathInt64(key string) (v int64, err error) {
+	err = mustDecode(g, func(g *Gear, _ any) (err error) {
+		v, err = g.PathInt64(key)
+		return
+	}, nil)
+	return
+}
+
+// Query returns the parsed URL query of the request.
+// Unlike g.R.URL.Query(), which reparses the raw query each call, the query is parsed once
+// per request and cached for repeated lookups, until the request(see [Gear.SetRequest])
+// or its raw query changes. The returned value is shared and should not be modified.
+func (g *Gear) Query() url.Values {
+	if g.query == nil || g.rawQuery != g.R.URL.RawQuery {
+		g.query, _ = url.ParseQuery(g.R.URL.RawQuery)
+		g.rawQuery = g.R.URL.RawQuery
+	}
+	return g.query
+}
+
+// QueryParam returns the first value associated with key in the URL query of the request,
+// or def if the key is not present.
+// The query is parsed once per request, so repeated lookups are cheap.
+func (g *Gear) QueryParam(key, def string) string {
+	if values := g.Query()[key]; len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
+
+// FormParam returns the first value associated with key in the form of the request,
+// including both the URL query and the POST, PUT or PATCH body, or def if the key is not present.
+// FormParam calls g.R.ParseForm(), which parses the form once per request.
+// Call ParseMultipartForm() of the request to include values in multi-part form.
+func (g *Gear) FormParam(key, def string) string {
+	LogIfErr(g.R.ParseForm())
+	if values := g.R.Form[key]; len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
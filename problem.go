@@ -0,0 +1,68 @@
+package gear
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mkch/gear/encoding"
+)
+
+// Problem is an RFC 7807 problem details object, see [Gear.Problem].
+type Problem struct {
+	// Type is a URI reference that identifies the problem type.
+	// Empty Type is omitted and means "about:blank".
+	Type string
+	// Title is a short, human-readable summary of the problem type.
+	Title string
+	// Status is the HTTP status code.
+	Status int
+	// Detail is a human-readable explanation specific to this occurrence of the problem.
+	Detail string
+	// Instance is a URI reference that identifies the specific occurrence of the problem.
+	Instance string
+	// Extensions are the extension members. The keys of the standard members above are ignored.
+	Extensions map[string]any
+}
+
+// MarshalJSON implements [json.Marshaler]. Empty members are omitted,
+// and the extension members are at the same level as the standard ones.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	var m = make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	for k, v := range map[string]any{"type": p.Type, "title": p.Title, "detail": p.Detail, "instance": p.Instance} {
+		delete(m, k)
+		if v != "" {
+			m[k] = v
+		}
+	}
+	delete(m, "status")
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	return json.Marshal(m)
+}
+
+// Problem writes code and p as RFC 7807 problem details to the response,
+// with Content-Type header set to [encoding.MIME_PROBLEM_JSON].
+// If p.Status is zero, it is set to code. If both p.Type and p.Title are empty,
+// p.Title is set to the status text of code.
+// Like [Gear.JSONResponse], nothing is written if the encoding fails.
+func (g *Gear) Problem(code int, p Problem) error {
+	if p.Status == 0 {
+		p.Status = code
+	}
+	if p.Type == "" && p.Title == "" {
+		p.Title = http.StatusText(code)
+	}
+	var buf bytes.Buffer
+	if err := encoding.EncodeJSON(p, &buf); err != nil {
+		return err
+	}
+	g.W.Header().Set("Content-Type", encoding.MIME_PROBLEM_JSON)
+	g.W.WriteHeader(code)
+	_, err := buf.WriteTo(g.W)
+	return clientGone(err)
+}
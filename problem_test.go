@@ -0,0 +1,37 @@
+package gear_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gear/encoding"
+)
+
+func TestProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).Problem(http.StatusForbidden, gear.Problem{
+			Detail:     "no credit",
+			Extensions: map[string]any{"balance": 30, "status": "ignored"},
+		})
+	}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusForbidden || w.Header().Get("Content-Type") != encoding.MIME_PROBLEM_JSON {
+		t.Fatal(w.Code, w.Header())
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(body, map[string]any{
+		"title":   "Forbidden",
+		"status":  float64(http.StatusForbidden),
+		"detail":  "no credit",
+		"balance": float64(30),
+	}) {
+		t.Fatal(body)
+	}
+}
@@ -0,0 +1,36 @@
+package gear
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/mkch/gg"
+)
+
+// Proxy forwards the request to target and copies the response back to g.W, for simple API gateways
+// fronting internal services. The request is rewritten as [httputil.NewSingleHostReverseProxy] does:
+// the path of target is joined with the request path, and the queries are combined.
+// The Host header is kept as is. The client IP is appended to X-Forwarded-For header, and
+// X-Forwarded-Proto header is set to the scheme of the request, replacing the one from the client.
+// The upstream request is canceled when the context of g.R is done.
+// If the upstream can't be reached, http.StatusBadGateway is written and the error is returned.
+// If the client has gone, nothing is written and the error returned wraps [ErrClientGone].
+func (g *Gear) Proxy(target *url.URL) (err error) {
+	var proxy = httputil.NewSingleHostReverseProxy(target)
+	var director = proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Header.Set("X-Forwarded-Proto", gg.If(r.TLS != nil, "https", "http"))
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, e error) {
+		if ctxErr := r.Context().Err(); ctxErr != nil {
+			err = clientGone(ctxErr)
+			return
+		}
+		err = e
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	proxy.ServeHTTP(g.W, g.R)
+	return
+}
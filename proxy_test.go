@@ -0,0 +1,48 @@
+package gear_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gg"
+)
+
+func TestProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%s %s|%s|%s", r.Method, r.URL.RequestURI(), r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Forwarded-Proto"))
+	}))
+	defer upstream.Close()
+	target := gg.Must(url.Parse(upstream.URL + "/api"))
+
+	var proxyErr error
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxyErr = gear.G(r).Proxy(target)
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/users?id=1", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-Proto", "https") // Spoofed.
+	handler.ServeHTTP(w, r)
+	if proxyErr != nil {
+		t.Fatal(proxyErr)
+	}
+	if w.Code != http.StatusCreated || w.Header().Get("X-Upstream") != "1" {
+		t.Fatal(w.Code, w.Header())
+	}
+	if body := w.Body.String(); body != "POST /api/users?id=1|192.0.2.1|http" {
+		t.Fatal(body)
+	}
+
+	upstream.Close()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if proxyErr == nil || w.Code != http.StatusBadGateway {
+		t.Fatal(proxyErr, w.Code)
+	}
+}
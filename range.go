@@ -0,0 +1,101 @@
+package gear
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRange is returned by [Gear.Ranges] if the Range header of the request is malformed.
+// Handlers can ignore the header and send the whole content in such cases.
+var ErrInvalidRange = errors.New("gear: invalid range")
+
+// ErrRangeNotSatisfiable is returned by [Gear.Ranges] if none of the ranges in the Range header
+// of the request overlaps the content. Handlers should send http.StatusRequestedRangeNotSatisfiable
+// with Content-Range header "bytes */size" in such cases.
+var ErrRangeNotSatisfiable = errors.New("gear: range not satisfiable")
+
+// Range is a byte range of the content requested in the Range header, see [Gear.Ranges].
+type Range struct {
+	Start  int64 // Offset of the first byte.
+	Length int64 // Number of bytes, always positive.
+}
+
+// ContentRange returns the value of Content-Range header for r of the content of size bytes.
+func (r Range) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// Ranges parses the Range header of the request into byte ranges of the content of size bytes,
+// so handlers streaming content from non-file sources, a database blob for example, can serve
+// partial content and resumable downloads, which [http.ServeContent] does for io.ReadSeeker only.
+// The ranges are in the order requested, and clipped to the content. The ones beyond the content are dropped.
+// If there is no Range header, Ranges returns nil and no error.
+// If the header is malformed, [ErrInvalidRange] is returned.
+// If none of the ranges overlaps the content, [ErrRangeNotSatisfiable] is returned.
+func (g *Gear) Ranges(size int64) ([]Range, error) {
+	return parseRanges(g.R.Header.Get("Range"), size)
+}
+
+// parseRanges parses the Range header value s, see [Gear.Ranges].
+func parseRanges(s string, size int64) ([]Range, error) {
+	if s == "" {
+		return nil, nil
+	}
+	const prefix = "bytes="
+	if !strings.HasPrefix(s, prefix) {
+		return nil, ErrInvalidRange
+	}
+	var ranges []Range
+	var noOverlap bool
+	for _, spec := range strings.Split(s[len(prefix):], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		var r Range
+		if first == "" {
+			// Suffix range: the last bytes of the content.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 || last[0] == '+' {
+				return nil, ErrInvalidRange
+			}
+			if n == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			n = min(n, size)
+			r = Range{Start: size - n, Length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 || first[0] == '+' {
+				return nil, ErrInvalidRange
+			}
+			var end = size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start || last[0] == '+' {
+					return nil, ErrInvalidRange
+				}
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			r = Range{Start: start, Length: min(end, size-1) - start + 1}
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		if noOverlap {
+			return nil, ErrRangeNotSatisfiable
+		}
+		return nil, ErrInvalidRange
+	}
+	return ranges, nil
+}
@@ -0,0 +1,47 @@
+package gear_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+func TestRanges(t *testing.T) {
+	for _, test := range []struct {
+		header string
+		ranges []gear.Range
+		err    error
+	}{
+		{"", nil, nil},
+		{"bytes=0-99", []gear.Range{{0, 100}}, nil},
+		{"bytes=0-", []gear.Range{{0, 1000}}, nil},
+		{"bytes=900-2000", []gear.Range{{900, 100}}, nil},
+		{"bytes=-100", []gear.Range{{900, 100}}, nil},
+		{"bytes=-2000", []gear.Range{{0, 1000}}, nil},
+		{"bytes=0-0, 500-599 ,-1", []gear.Range{{0, 1}, {500, 100}, {999, 1}}, nil},
+		{"bytes=0-9,1000-", []gear.Range{{0, 10}}, nil},
+		{"bytes=1000-", nil, gear.ErrRangeNotSatisfiable},
+		{"bytes=-0", nil, gear.ErrRangeNotSatisfiable},
+		{"items=0-9", nil, gear.ErrInvalidRange},
+		{"bytes=9-0", nil, gear.ErrInvalidRange},
+		{"bytes=a-", nil, gear.ErrInvalidRange},
+		{"bytes=5", nil, gear.ErrInvalidRange},
+		{"bytes=", nil, gear.ErrInvalidRange},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.header != "" {
+			r.Header.Set("Range", test.header)
+		}
+		ranges, err := gear.NewTestGear(httptest.NewRecorder(), r).Ranges(1000)
+		if !errors.Is(err, test.err) || !reflect.DeepEqual(ranges, test.ranges) {
+			t.Fatal(test.header, ranges, err)
+		}
+	}
+	if cr := (gear.Range{Start: 900, Length: 100}).ContentRange(1000); cr != "bytes 900-999/1000" {
+		t.Fatal(cr)
+	}
+}
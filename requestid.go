@@ -0,0 +1,75 @@
+package gear
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestIDCtxKey is the context key of the request ID in http.Request.Context().
+const requestIDCtxKey contextKey = "requestID"
+
+// maxRequestIDLen is the maximum length of the request ID accepted from the client by [RequestID].
+const maxRequestIDLen = 128
+
+// validRequestID returns whether id is a non-empty string of visible ASCII characters
+// no longer than maxRequestIDLen, which is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request ID of 32 hex digits.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestIDFromContext returns the request ID stored in ctx by [RequestID], or "" if there is none.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey).(string)
+	return id
+}
+
+// requestID returns the request ID of r: the one stored by [RequestID] in the context of r,
+// or the [RequestIDHeader] header of r if the middleware is not used.
+func requestID(r *http.Request) string {
+	if id := requestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	return r.Header.Get(RequestIDHeader)
+}
+
+// RequestID returns the ID of the request assigned by the [RequestID] middleware,
+// or the [RequestIDHeader] header of the request if the middleware is not used.
+func (g *Gear) RequestID() string {
+	return requestID(g.R)
+}
+
+// RequestID returns a [Middleware] which assigns an ID to each request and stores it in the request context.
+// The [RequestIDHeader] header of the request is used if it is made of at most 128 visible ASCII characters,
+// otherwise a random ID is generated. The ID is sent back in the RequestIDHeader header of the response.
+// [Logger], [PanicRecovery] and [Gear.LogValue] include the ID as the "request_id" attribute,
+// correlating the access log, the panic log and the handler logs of the same request.
+// Middlewares are served from the last to the first, so RequestID should be added after the middlewares
+// logging the request, [Logger] for example, but before PanicRecovery.
+func RequestID() Middleware {
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var id = g.R.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		g.SetContextValue(requestIDCtxKey, id)
+		g.W.Header().Set(RequestIDHeader, id)
+		next(g)
+	}, "RequestID")
+}
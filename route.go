@@ -0,0 +1,40 @@
+package gear
+
+import (
+	"net/http"
+)
+
+// HandleMethod registers f for the method-qualified pattern "method pattern" on mux.
+// The handler and middlewares are wrapped(see [Wrap]) before registering.
+// If mux is nil, http.DefaultServeMux will be used.
+func HandleMethod(mux *http.ServeMux, method, pattern string, f http.HandlerFunc, middlewares ...Middleware) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	mux.Handle(method+" "+pattern, Wrap(f, middlewares...))
+}
+
+// GET calls [HandleMethod] with http.MethodGet.
+func GET(mux *http.ServeMux, pattern string, f http.HandlerFunc, middlewares ...Middleware) {
+	HandleMethod(mux, http.MethodGet, pattern, f, middlewares...)
+}
+
+// POST calls [HandleMethod] with http.MethodPost.
+func POST(mux *http.ServeMux, pattern string, f http.HandlerFunc, middlewares ...Middleware) {
+	HandleMethod(mux, http.MethodPost, pattern, f, middlewares...)
+}
+
+// PUT calls [HandleMethod] with http.MethodPut.
+func PUT(mux *http.ServeMux, pattern string, f http.HandlerFunc, middlewares ...Middleware) {
+	HandleMethod(mux, http.MethodPut, pattern, f, middlewares...)
+}
+
+// DELETE calls [HandleMethod] with http.MethodDelete.
+func DELETE(mux *http.ServeMux, pattern string, f http.HandlerFunc, middlewares ...Middleware) {
+	HandleMethod(mux, http.MethodDelete, pattern, f, middlewares...)
+}
+
+// PATCH calls [HandleMethod] with http.MethodPatch.
+func PATCH(mux *http.ServeMux, pattern string, f http.HandlerFunc, middlewares ...Middleware) {
+	HandleMethod(mux, http.MethodPatch, pattern, f, middlewares...)
+}
@@ -0,0 +1,33 @@
+package gear_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/mkch/gear"
+	"github.com/mkch/gear/internal/geartest"
+)
+
+func TestHandleMethod(t *testing.T) {
+	var mux http.ServeMux
+	var handler = func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r) // Must be wrapped.
+		fmt.Fprint(w, r.Method, " ", r.PathValue("id"))
+	}
+	gear.GET(&mux, "/item/{id}", handler)
+	gear.POST(&mux, "/item/{id}", handler)
+	gear.PUT(&mux, "/item/{id}", handler)
+	gear.DELETE(&mux, "/item/{id}", handler)
+	gear.PATCH(&mux, "/item/{id}", handler)
+	server := gear.NewTestServer(&mux)
+	defer server.Close()
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch} {
+		if body, _ := geartest.Curl(server.URL+"/item/1", "-X", method); string(body) != method+" 1" {
+			t.Fatal(string(body))
+		}
+	}
+	if _, vars := geartest.Curl(server.URL+"/item/1", "-X", http.MethodOptions); vars["response_code"] != float64(http.StatusMethodNotAllowed) {
+		t.Fatal(vars["response_code"])
+	}
+}
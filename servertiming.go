@@ -0,0 +1,90 @@
+package gear
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverTimingKey is the key of the timing marks stored in Gear by [ServerTiming], see [Gear.Set].
+const serverTimingKey = "gear.ServerTiming"
+
+// ServerTimingTotal is the name of the mark added by [ServerTiming] for the time spent
+// from entering the middleware to writing the response header.
+const ServerTimingTotal = "total"
+
+// serverTimingMark is a timing mark recorded by [Gear.Timing].
+type serverTimingMark struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTiming is the timing marks of a request.
+type serverTiming struct {
+	marks []serverTimingMark
+	sent  bool // Whether the marks have been sent in the header.
+}
+
+// add adds d to the mark named name, or appends a new mark if there is no such mark.
+func (t *serverTiming) add(name string, d time.Duration) {
+	if t.sent {
+		return
+	}
+	if i := slices.IndexFunc(t.marks, func(m serverTimingMark) bool { return m.name == name }); i >= 0 {
+		t.marks[i].dur += d
+		return
+	}
+	t.marks = append(t.marks, serverTimingMark{name, d})
+}
+
+// String returns the marks as the value of Server-Timing header.
+func (t *serverTiming) String() string {
+	var b strings.Builder
+	for i, m := range t.marks {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(m.name)
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(m.dur.Round(time.Microsecond))/float64(time.Millisecond), 'f', -1, 64))
+	}
+	return b.String()
+}
+
+// Timing records a timing mark named name with duration d, which is sent in the Server-Timing
+// response header by [ServerTiming]. The durations of the marks with the same name are summed.
+// name should be a token, such as "db" or "render".
+// Timing does nothing if ServerTiming is not in use, or after the response header is written.
+//
+//	start := time.Now()
+//	rows := queryDB()
+//	g.Timing("db", time.Since(start))
+func (g *Gear) Timing(name string, d time.Duration) {
+	if v, ok := g.Get(serverTimingKey); ok {
+		v.(*serverTiming).add(name, d)
+	}
+}
+
+// ServerTiming returns a [Middleware] which sends the timing marks recorded by [Gear.Timing]
+// in the Server-Timing response header, right before the header is written, so the backend
+// phase timings show up in browser devtools. A [ServerTimingTotal] mark is appended for the time
+// spent from entering the middleware to writing the response header.
+func ServerTiming() Middleware {
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var start = time.Now()
+		var timing = &serverTiming{}
+		g.Set(serverTimingKey, timing)
+		var w = g.W
+		var hw = newHookWriter(w, func(w http.ResponseWriter) {
+			timing.add(ServerTimingTotal, time.Since(start))
+			timing.sent = true
+			w.Header().Add("Server-Timing", timing.String())
+		})
+		g.W = hw
+		defer func() { g.W = w }()
+		next(g)
+		hw.writeHeader() // Add the header if nothing has been written by the handler.
+	}, "ServerTiming")
+}
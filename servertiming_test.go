@@ -0,0 +1,43 @@
+package gear_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/mkch/gear"
+)
+
+func TestServerTiming(t *testing.T) {
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := gear.G(r)
+		g.Timing("db", 2*time.Millisecond)
+		g.Timing("render", 1500*time.Microsecond)
+		g.Timing("db", 3*time.Millisecond)
+		io.WriteString(w, "ok")
+		g.Timing("late", time.Millisecond) // Discarded.
+	}, gear.ServerTiming())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if timing := w.Header().Get("Server-Timing"); !regexp.MustCompile(`^db;dur=5, render;dur=1\.5, total;dur=[0-9.]+$`).MatchString(timing) {
+		t.Fatal(timing)
+	}
+
+	// Without ServerTiming, Timing does nothing.
+	g := gear.NewTestGear(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	g.Timing("db", time.Millisecond)
+}
+
+func TestServerTimingEmptyResponse(t *testing.T) {
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		gear.G(r).Timing("db", time.Millisecond)
+	}, gear.ServerTiming())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if timing := w.Header().Get("Server-Timing"); !regexp.MustCompile(`^db;dur=1, total;dur=[0-9.]+$`).MatchString(timing) {
+		t.Fatal(timing)
+	}
+}
@@ -0,0 +1,104 @@
+package gear
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// singleFlightResponse is a response shared by [SingleFlight].
+type singleFlightResponse struct {
+	header http.Header // The header entries set by the handler.
+	body   []byte
+}
+
+// singleFlightCall is an in-flight or completed handler call of [SingleFlight].
+type singleFlightCall struct {
+	done chan struct{}         // Closed when the call completes.
+	resp *singleFlightResponse // The response to share, nil if not shareable.
+}
+
+// singleFlightKey is the default key function of [SingleFlight].
+// GET and HEAD requests are keyed by method and URL. Other requests, and the requests with credentials,
+// Authorization or Cookie header, which may get personalized responses, are not deduplicated.
+func singleFlightKey(r *http.Request) string {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return ""
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return ""
+	}
+	return r.Method + " " + r.URL.String()
+}
+
+// SingleFlight returns a [Middleware] which deduplicates concurrent requests with the same key,
+// so the expensive handler runs once for them and the response is shared, which cuts load spikes
+// of cache-miss stampedes. The response of the first request is buffered, and the requests arrive
+// while it is in flight get the same status code, header and body replayed, instead of running the handler.
+// Only http.StatusOK responses are shared, the waiting requests run the handler themselves otherwise.
+// If keyFunc returns "" for a request, the request is not deduplicated.
+// If keyFunc is nil, GET and HEAD requests without Authorization and Cookie headers are keyed by method and URL,
+// and other requests are not deduplicated, so personalized responses are never shared across users.
+// The handler should be idempotent, and the key must capture everything the response depends on.
+func SingleFlight(keyFunc func(r *http.Request) string) Middleware {
+	if keyFunc == nil {
+		keyFunc = singleFlightKey
+	}
+	var mu sync.Mutex
+	var calls = make(map[string]*singleFlightCall)
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var key = keyFunc(g.R)
+		if key == "" || g.IsWebSocket() {
+			next(g)
+			return
+		}
+		mu.Lock()
+		if call := calls[key]; call != nil {
+			mu.Unlock()
+			select {
+			case <-call.done:
+			case <-g.Done():
+				return // Client gone.
+			}
+			if call.resp == nil {
+				next(g)
+				return
+			}
+			copyHeader(g.W.Header(), call.resp.header)
+			g.W.WriteHeader(http.StatusOK)
+			LogIfErrT(g.W.Write(call.resp.body))
+			g.Stop()
+			return
+		}
+		var call = &singleFlightCall{done: make(chan struct{})}
+		calls[key] = call
+		mu.Unlock()
+
+		var w = g.W
+		var initial = w.Header().Clone()
+		var bw = newBufferWriter(w)
+		g.W = bw
+		defer func() {
+			g.W = w
+			mu.Lock()
+			delete(calls, key)
+			mu.Unlock()
+			close(call.done) // Let the waiting requests run the handler themselves if panicking.
+		}()
+		next(g)
+		if bw.streaming {
+			return
+		}
+		if bw.status() == http.StatusOK {
+			// Share the header entries set by the handler only, not those set for this request before it.
+			var header = make(http.Header)
+			for k, v := range bw.header {
+				if !slices.Equal(initial[k], v) {
+					header[k] = slices.Clone(v)
+				}
+			}
+			call.resp = &singleFlightResponse{header: header, body: bw.body.Bytes()}
+		}
+		LogIfErr(bw.replay(w, bw.body.Bytes()))
+	}, "SingleFlight")
+}
@@ -0,0 +1,73 @@
+package gear_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mkch/gear"
+)
+
+func TestSingleFlight(t *testing.T) {
+	var calls atomic.Int32
+	var code atomic.Int32
+	code.Store(http.StatusOK)
+	handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("X-Result", "computed")
+		w.WriteHeader(int(code.Load()))
+		io.WriteString(w, "result")
+	}, gear.SingleFlight(nil))
+
+	serve := func(n int, cookie string) []*httptest.ResponseRecorder {
+		var recorders = make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		for i := range recorders {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(w *httptest.ResponseRecorder) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodGet, "/expensive", nil)
+				if cookie != "" {
+					r.Header.Set("Cookie", cookie)
+				}
+				handler.ServeHTTP(w, r)
+			}(recorders[i])
+			if i == 0 {
+				time.Sleep(20 * time.Millisecond) // Let the first request be in flight.
+			}
+		}
+		wg.Wait()
+		return recorders
+	}
+
+	for _, w := range serve(5, "") {
+		if w.Code != http.StatusOK || w.Body.String() != "result" || w.Header().Get("X-Result") != "computed" {
+			t.Fatal(w.Code, w.Body.String(), w.Header())
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatal(n)
+	}
+
+	// Non-200 responses are not shared.
+	calls.Store(0)
+	code.Store(http.StatusInternalServerError)
+	serve(3, "")
+	if n := calls.Load(); n != 3 {
+		t.Fatal(n)
+	}
+
+	// Requests with credentials are not shared by default.
+	calls.Store(0)
+	code.Store(http.StatusOK)
+	serve(3, "session=1")
+	if n := calls.Load(); n != 3 {
+		t.Fatal(n)
+	}
+}
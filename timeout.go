@@ -0,0 +1,103 @@
+package gear
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// readTimeoutWriter is the http.ResponseWriter used by [ReadTimeout].
+// After the timeout response is written, it discards further writes.
+type readTimeoutWriter struct {
+	http.ResponseWriter
+	wroteHeader bool // Whether the header has been written.
+	timedOut    bool // Whether the timeout response has been written.
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (w *readTimeoutWriter) WriteHeader(statusCode int) {
+	if w.timedOut {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements [http.ResponseWriter].
+func (w *readTimeoutWriter) Write(p []byte) (int, error) {
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements [http.Flusher].
+func (w *readTimeoutWriter) Flush() {
+	if w.timedOut {
+		return
+	}
+	w.wroteHeader = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, see [http.ResponseController].
+func (w *readTimeoutWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// timeout writes a http.StatusRequestTimeout response if nothing has been written.
+func (w *readTimeoutWriter) timeout() {
+	if w.wroteHeader || w.timedOut {
+		return
+	}
+	w.Header().Set("Connection", "close")
+	http.Error(w.ResponseWriter, http.StatusText(http.StatusRequestTimeout), http.StatusRequestTimeout)
+	w.timedOut = true
+}
+
+// readTimeoutBody is the request body used by [ReadTimeout].
+type readTimeoutBody struct {
+	io.ReadCloser
+	w *readTimeoutWriter
+}
+
+// Read implements [io.Reader].
+func (body *readTimeoutBody) Read(p []byte) (n int, err error) {
+	n, err = body.ReadCloser.Read(p)
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		body.w.timeout()
+	}
+	return
+}
+
+// ReadTimeout returns a [Middleware] which bounds how long reading the request body may take
+// using [http.ResponseController.SetReadDeadline], to protect specific endpoints,
+// such as uploading, from slow clients without lowering the server read timeout globally.
+// If reading the body times out, a http.StatusRequestTimeout response is written
+// unless the handler has written something, and the further writes of the handler fail
+// with [http.ErrHandlerTimeout].
+// If setting read deadline is not supported, the request is handled without a deadline.
+func ReadTimeout(d time.Duration) Middleware {
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		var rc = http.NewResponseController(g.W)
+		if LogIfErr(rc.SetReadDeadline(time.Now().Add(d))) != nil {
+			next(g)
+			return
+		}
+		defer func() { LogIfErr(rc.SetReadDeadline(time.Time{})) }()
+
+		var w = g.W
+		var tw = &readTimeoutWriter{ResponseWriter: w}
+		g.W = tw
+		defer func() { g.W = w }()
+		if g.R.Body != nil && g.R.Body != http.NoBody {
+			var r = *g.R
+			r.Body = &readTimeoutBody{g.R.Body, tw}
+			g.SetRequest(&r)
+		}
+		next(g)
+	}, "ReadTimeout")
+}
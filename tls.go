@@ -0,0 +1,71 @@
+package gear
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// TLSOptions are options for [RequireTLS]. A zero TLSOptions consists entirely of zero values.
+type TLSOptions struct {
+	// Reject makes plaintext requests rejected with http.StatusForbidden.
+	// Zero value means plaintext GET and HEAD requests are redirected to https.
+	Reject bool
+	// TrustedProxies are the CIDRs of trusted proxies. The rightmost value of X-Forwarded-Proto header
+	// is honored only if the remote address of the request is a trusted proxy.
+	// Zero value means no proxy is trusted and the header is ignored to avoid spoofing.
+	// See [ClientIPOptions] for the same trust model.
+	TrustedProxies []netip.Prefix
+}
+
+// isTLS returns whether r is served over TLS, directly or via a trusted proxy.
+func isTLS(r *http.Request, trustedProxies []netip.Prefix) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if values := r.Header.Values("X-Forwarded-Proto"); len(values) > 0 && remoteTrusted(r, trustedProxies) {
+		// The rightmost value is set by the trusted proxy, the others may be spoofed by the client.
+		var proto = values[len(values)-1]
+		if i := strings.LastIndexByte(proto, ','); i >= 0 {
+			proto = proto[i+1:]
+		}
+		return strings.EqualFold(strings.TrimSpace(proto), "https")
+	}
+	return false
+}
+
+// RequireTLS returns a [Middleware] which enforces HTTPS.
+// A plaintext request, detected by g.R.TLS or X-Forwarded-Proto header from a trusted proxy,
+// is either redirected to the https equivalent with http.StatusMovedPermanently, or rejected
+// with http.StatusForbidden, per opt. Requests with methods other than GET and HEAD are always
+// rejected, because redirecting would lose the body.
+// If opt is nil, the default options are used.
+func RequireTLS(opt *TLSOptions) Middleware {
+	var reject bool
+	var trustedProxies []netip.Prefix
+	if opt != nil {
+		reject = opt.Reject
+		trustedProxies = opt.TrustedProxies
+	}
+	return MiddlewareFuncWitName(func(g *Gear, next func(*Gear)) {
+		if isTLS(g.R, trustedProxies) {
+			next(g)
+			return
+		}
+		if reject || (g.R.Method != http.MethodGet && g.R.Method != http.MethodHead) {
+			g.Code(http.StatusForbidden)
+			g.Stop()
+			return
+		}
+		var host = g.R.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]" // IPv6
+			}
+		}
+		http.Redirect(g.W, g.R, "https://"+host+g.R.URL.RequestURI(), http.StatusMovedPermanently)
+		g.Stop()
+	}, "RequireTLS")
+}
@@ -0,0 +1,45 @@
+package gear_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/mkch/gear"
+)
+
+func TestRequireTLS(t *testing.T) {
+	var trusted = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	var tests = []struct {
+		method   string
+		remote   string
+		proto    string
+		opt      *gear.TLSOptions
+		code     int
+		location string
+	}{
+		{http.MethodGet, "192.0.2.1:1", "", nil, http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{http.MethodPost, "192.0.2.1:1", "", nil, http.StatusForbidden, ""},
+		{http.MethodGet, "192.0.2.1:1", "", &gear.TLSOptions{Reject: true}, http.StatusForbidden, ""},
+		{http.MethodGet, "192.0.2.1:1", "https", nil, http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{http.MethodGet, "192.0.2.1:1", "https", &gear.TLSOptions{TrustedProxies: trusted}, http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{http.MethodGet, "10.0.0.1:1", "https", &gear.TLSOptions{TrustedProxies: trusted}, http.StatusOK, ""},
+		{http.MethodGet, "10.0.0.1:1", "http", &gear.TLSOptions{TrustedProxies: trusted}, http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{http.MethodGet, "10.0.0.1:1", "http, https", &gear.TLSOptions{TrustedProxies: trusted}, http.StatusOK, ""},
+		{http.MethodGet, "10.0.0.1:1", "https, http", &gear.TLSOptions{TrustedProxies: trusted}, http.StatusMovedPermanently, "https://example.com/a?b=c"},
+	}
+	for _, test := range tests {
+		handler := gear.WrapFunc(func(w http.ResponseWriter, r *http.Request) {}, gear.RequireTLS(test.opt))
+		r := httptest.NewRequest(test.method, "http://example.com:8080/a?b=c", nil)
+		r.RemoteAddr = test.remote
+		if test.proto != "" {
+			r.Header.Set("X-Forwarded-Proto", test.proto)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.code || w.Header().Get("Location") != test.location {
+			t.Fatal(test, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
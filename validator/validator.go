@@ -35,6 +35,12 @@ func Register(v Validator) {
 	validator = v
 }
 
+// Unregister removes the registered validator, if any, so values are not validated again.
+// It is useful to restore the state in tests.
+func Unregister() {
+	validator = nil
+}
+
 // Registered returns whether a validator has been registered.
 func Registered() bool {
 	return validator != nil
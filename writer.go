@@ -0,0 +1,349 @@
+package gear
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// hookWriter is a http.ResponseWriter which calls a hook function
+// right before the response header is written.
+type hookWriter struct {
+	http.ResponseWriter
+	beforeHeader func(w http.ResponseWriter) // Called once before the header is written.
+	wroteHeader  bool                        // Whether the header has been written.
+}
+
+// newHookWriter returns a hookWriter wraps w and calls beforeHeader(w) once
+// right before the response header is written.
+func newHookWriter(w http.ResponseWriter, beforeHeader func(w http.ResponseWriter)) *hookWriter {
+	return &hookWriter{ResponseWriter: w, beforeHeader: beforeHeader}
+}
+
+// writeHeader calls the hook if the header has not been written.
+func (w *hookWriter) writeHeader() {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.beforeHeader(w.ResponseWriter)
+	}
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (w *hookWriter) WriteHeader(statusCode int) {
+	w.writeHeader()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements [http.ResponseWriter].
+func (w *hookWriter) Write(p []byte) (int, error) {
+	w.writeHeader()
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements [http.Flusher].
+func (w *hookWriter) Flush() {
+	w.writeHeader()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, see [http.ResponseController].
+func (w *hookWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// headerWritten returns whether the response header has been written to w.
+// Only the writers of this package know it, so w and the writers it wraps(see [http.ResponseController])
+// are searched for one of them. If none is found, known is false.
+func headerWritten(w http.ResponseWriter) (written, known bool) {
+	for {
+		switch rw := w.(type) {
+		case *hookWriter:
+			return rw.wroteHeader, true
+		case *captureWriter:
+			return rw.statusCode != 0, true
+		case *bufferWriter:
+			return rw.streaming, true // Never written to the underlying writer before replay unless streaming.
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return false, false
+		}
+	}
+}
+
+// copyHeader copies all the values of src to dst, replacing the values of the same keys in dst.
+// The values are copied, not shared, so multi-valued headers such as Set-Cookie are preserved.
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+}
+
+// trailerKeys returns the canonical keys of the trailers declared in Trailer header of h.
+func trailerKeys(h http.Header) (keys []string) {
+	for _, v := range h["Trailer"] {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				keys = append(keys, http.CanonicalHeaderKey(key))
+			}
+		}
+	}
+	return
+}
+
+// trailers returns the trailers in h, both the declared ones(see [trailerKeys]) which have values
+// and those prefixed with http.TrailerPrefix, as keys prefixed with http.TrailerPrefix, so they are
+// sent as trailers even if replayed before the body.
+func trailers(h http.Header) http.Header {
+	var t = make(http.Header)
+	for _, key := range trailerKeys(h) {
+		if v, ok := h[key]; ok {
+			t[http.TrailerPrefix+key] = append([]string(nil), v...)
+		}
+	}
+	for k, v := range h {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			t[k] = append([]string(nil), v...)
+		}
+	}
+	return t
+}
+
+// captureWriter is a http.ResponseWriter which records the status code and header,
+// and optionally copies the body written.
+type captureWriter struct {
+	http.ResponseWriter
+	statusCode int           // Status code written, 0 if not written yet.
+	header     http.Header   // Clone of the header when it was written, nil if not written yet.
+	written    int64         // Number of body bytes written.
+	body       *bytes.Buffer // If not nil, the body written is copied into it.
+	maxBody    int           // Maximum number of bytes copied into body, negative means no limit.
+}
+
+// newCaptureWriter returns a captureWriter wraps w.
+// At most maxBody bytes of the body written will be copied, negative maxBody means no limit.
+func newCaptureWriter(w http.ResponseWriter, maxBody int) *captureWriter {
+	var cw = &captureWriter{ResponseWriter: w, maxBody: maxBody}
+	if maxBody != 0 {
+		cw.body = &bytes.Buffer{}
+	}
+	return cw
+}
+
+// capture records statusCode and the header if nothing has been recorded.
+func (w *captureWriter) capture(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+		w.header = w.Header().Clone()
+	}
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (w *captureWriter) WriteHeader(statusCode int) {
+	w.capture(statusCode)
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements [http.ResponseWriter].
+func (w *captureWriter) Write(p []byte) (n int, err error) {
+	w.capture(http.StatusOK)
+	n, err = w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	if w.body != nil {
+		if w.maxBody < 0 {
+			w.body.Write(p[:n])
+		} else if remain := w.maxBody - w.body.Len(); remain > 0 {
+			w.body.Write(p[:min(n, remain)])
+		}
+	}
+	return
+}
+
+// Flush implements [http.Flusher].
+func (w *captureWriter) Flush() {
+	w.capture(http.StatusOK)
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, see [http.ResponseController].
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// status returns the status code written, or http.StatusOK if nothing has been written.
+func (w *captureWriter) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// headers returns the header written, or a clone of the current header if nothing has been written.
+// Changes made to the header after it is written are not sent, so they are not included,
+// except the trailers(see [trailers]), which are included as keys prefixed with http.TrailerPrefix.
+func (w *captureWriter) headers() http.Header {
+	var header http.Header
+	if w.header == nil {
+		header = w.Header().Clone()
+	} else {
+		header = w.header.Clone()
+	}
+	for _, key := range trailerKeys(header) {
+		delete(header, key) // Sent as trailers instead.
+	}
+	copyHeader(header, trailers(w.Header()))
+	return header
+}
+
+// bufferWriter is a http.ResponseWriter which buffers the header, status code and body
+// instead of writing them to the underlying http.ResponseWriter.
+// Server-sent event streams(see [Gear.IsEventStream]) are not buffered but streamed to the underlying writer.
+type bufferWriter struct {
+	w          http.ResponseWriter // The underlying writer.
+	header     http.Header         // The header, initialized to a clone of the underlying one.
+	statusCode int                 // Status code written, 0 if not written yet.
+	body       bytes.Buffer        // The body written.
+	streaming  bool                // Whether the response is streamed to the underlying writer.
+}
+
+// newBufferWriter returns a bufferWriter whose header is initialized to a clone of w.Header().
+func newBufferWriter(w http.ResponseWriter) *bufferWriter {
+	return &bufferWriter{w: w, header: w.Header().Clone()}
+}
+
+// Header implements [http.ResponseWriter].
+func (w *bufferWriter) Header() http.Header {
+	if w.streaming {
+		return w.w.Header()
+	}
+	return w.header
+}
+
+// stream switches to streaming mode if the status code has been written and the response is an event stream,
+// replaying the header and status code to the underlying writer. It returns whether in streaming mode.
+func (w *bufferWriter) stream() bool {
+	if w.streaming {
+		return true
+	}
+	if w.statusCode == 0 || !isEventStream(w.header) {
+		return false
+	}
+	w.streaming = true
+	LogIfErr(w.replay(w.w, w.body.Bytes()))
+	w.body.Reset()
+	return true
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (w *bufferWriter) WriteHeader(statusCode int) {
+	if w.streaming {
+		w.w.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.stream()
+}
+
+// Write implements [http.ResponseWriter].
+func (w *bufferWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if w.stream() {
+		return w.w.Write(p)
+	}
+	return w.body.Write(p)
+}
+
+// Flush implements [http.Flusher]. Only event streams are flushed.
+func (w *bufferWriter) Flush() {
+	if w.statusCode == 0 && isEventStream(w.header) {
+		w.statusCode = http.StatusOK
+	}
+	if w.stream() {
+		http.NewResponseController(w.w).Flush()
+	}
+}
+
+// status returns the status code written, or http.StatusOK if nothing has been written.
+func (w *bufferWriter) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// replay writes the buffered header and status code, followed by body, to dst.
+func (w *bufferWriter) replay(dst http.ResponseWriter, body []byte) error {
+	var header = dst.Header()
+	clear(header)
+	copyHeader(header, w.header)
+	dst.WriteHeader(w.status())
+	_, err := dst.Write(body)
+	return err
+}
+
+// defaultNotFoundBody is the body of the not found response of [http.NotFound].
+const defaultNotFoundBody = "404 page not found\n"
+
+// notFoundWriter is the http.ResponseWriter used by [WrapWithNotFound].
+// A http.StatusNotFound response is held back, as long as its body is empty or a prefix of the default one,
+// to be replaced by the custom not found handler.
+type notFoundWriter struct {
+	http.ResponseWriter
+	held    bool         // Whether a not found response is being held back.
+	written bool         // Whether the header has been written to the underlying writer.
+	body    bytes.Buffer // The body of the held response.
+}
+
+// release writes the held response to the underlying writer.
+func (w *notFoundWriter) release() {
+	w.held = false
+	w.written = true
+	w.ResponseWriter.WriteHeader(http.StatusNotFound)
+	LogIfErrT(w.body.WriteTo(w.ResponseWriter))
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (w *notFoundWriter) WriteHeader(statusCode int) {
+	if w.held {
+		return
+	}
+	if statusCode == http.StatusNotFound && !w.written {
+		w.held = true
+		return
+	}
+	if statusCode >= 200 {
+		w.written = true
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write implements [http.ResponseWriter].
+func (w *notFoundWriter) Write(p []byte) (int, error) {
+	if w.held {
+		w.body.Write(p)
+		if !strings.HasPrefix(defaultNotFoundBody, w.body.String()) {
+			w.release()
+		}
+		return len(p), nil
+	}
+	w.written = true
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush implements [http.Flusher].
+func (w *notFoundWriter) Flush() {
+	if w.held {
+		w.release()
+	}
+	w.written = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, see [http.ResponseController].
+func (w *notFoundWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}